@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pako-23/queue-scaler/internal/queue"
+)
+
+var errInvalidReplicas = errors.New("replicas must be in the form service=count")
+
+type replicasFlag map[string]int32
+
+func (r replicasFlag) String() string {
+	pairs := make([]string, 0, len(r))
+	for service, count := range r {
+		pairs = append(pairs, fmt.Sprintf("%s=%d", service, count))
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (r replicasFlag) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		service, count, ok := strings.Cut(pair, "=")
+		if !ok || service == "" {
+			return errInvalidReplicas
+		}
+
+		replicas, err := strconv.ParseInt(count, 10, 32)
+		if err != nil || replicas < 1 {
+			return errInvalidReplicas
+		}
+
+		r[service] = int32(replicas)
+	}
+
+	return nil
+}
+
+func analyze(args []string) error {
+	replicas := replicasFlag{}
+
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	flags.Var(replicas, "replicas", "comma separated list of service=count (default 1 per service)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s analyze [-replicas service=count,...] snapshot.json\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	state := queue.NewQueueNetwork()
+	if err := json.Unmarshal(data, state); err != nil {
+		return err
+	}
+
+	fmt.Print(state.Analyze(replicas).Report())
+	return nil
+}
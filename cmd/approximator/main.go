@@ -2,50 +2,310 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 
+	"github.com/pako-23/queue-scaler/internal/certs"
 	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/forward"
 	"github.com/pako-23/queue-scaler/internal/observer"
+	"github.com/pako-23/queue-scaler/internal/queue"
 	"github.com/pako-23/queue-scaler/internal/receiver"
+	"github.com/pako-23/queue-scaler/internal/record"
+	"github.com/pako-23/queue-scaler/internal/scrape"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+// queueLengthIntervals is how many scrape intervals a measured queue length
+// is trusted for.
+const queueLengthIntervals = 3
+
+var subcommands = map[string]func([]string) error{
+	"analyze": analyze,
+	"replay":  replay,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			if err := subcommand(os.Args[2:]); err != nil {
+				log.Fatalf("failed with error: %v", err)
+			}
+			return
+		}
+	}
+
+	recordPath := flag.String("record", "", "write every received span, metric, queue length and published model to this file for later replay")
+	lateness := flag.Duration("event-time-lateness", 0,
+		"bucket requests by span start time, waiting this long for late spans (default: bucket by arrival time)")
+	bufferSize := flag.Int("buffer-size", 1024, "number of span batches buffered between the receiver and the observer")
+	policy := receiver.PolicyBlock
+	flag.Var(&policy, "policy", "what to do with spans when the buffer is full: block, drop-newest or sample")
+	scale := flag.Bool("scale", false, "scale the deployments of the cluster the approximator runs in")
+	maxWaitingTime := flag.Duration("max-waiting-time", 0, "when scaling, also add replicas until requests are predicted to wait at most this long at every service, accounting for the variability of service times")
+	minSamples := flag.Uint64("min-samples", 0, "when scaling, leave services whose arrival rate or service time are estimated from fewer requests unchanged")
+	maxRelativeWidth := flag.Float64("max-relative-width", 0, "when scaling, leave services unchanged while the 95% confidence interval of their arrival rate or service time is wider than this fraction of the estimate (0 disables)")
+	replicaBudget := flag.Int("replica-budget", 0, "when scaling, maximum number of replicas of all the deployments together (0 disables)")
+	serviceWeights := flag.String("service-weights", "", "comma-separated service=weight importance of the latency of requests entering at each service when sharing the replica budget (default 1)")
+	slos := flag.String("slo", "", "comma-separated entry=objective:target end-to-end latency objectives of the services receiving external requests, such as checkout=p95:300ms or search=mean:100ms")
+	concurrent := flag.Bool("concurrent-controllers", false, "run the controllers concurrently instead of one after the other")
+	tlsCert := flag.String("tls-cert", "", "certificate file of the OTLP receiver, reloaded on change (default: plaintext)")
+	tlsKey := flag.String("tls-key", "", "private key file of the OTLP receiver, reloaded on change")
+	tlsClientCA := flag.String("tls-client-ca", "", "require clients to present a certificate signed by one of these CAs")
+	authTokens := flag.String("auth-tokens", "", "JSON file mapping accepted tokens to the namespaces and services they may report for, namespaces covering the deployments they hold in the cluster (default: no authentication)")
+	reflection := flag.Bool("grpc-reflection", false, "register the gRPC reflection service on the OTLP receiver")
+	stopTimeout := flag.Duration("shutdown-timeout", receiver.DefaultStopTimeout, "how long in-flight exports may take to complete on shutdown")
+	shards := flag.Int("shards", runtime.GOMAXPROCS(0), "number of workers assembling traces")
+	acceptMetrics := flag.Bool("metrics", false, "also model services from OTLP span metrics and service graph metrics")
+	queuePrometheus := flag.String("queue-length-prometheus", "", "address of a Prometheus server queried for the number of requests in flight at each service")
+	queueQuery := flag.String("queue-length-query", scrape.DefaultQuery, "instant query returning the requests in flight, one series per service")
+	queueLabel := flag.String("queue-length-label", scrape.DefaultLabel, "label naming the service of each series returned by the query")
+	scrapeInterval := flag.Duration("scrape-interval", scrape.DefaultInterval, "how often the requests in flight are measured")
+	jaeger := flag.Bool("jaeger", false, "also accept Jaeger api_v2 batches on the OTLP receiver")
+	forwardTo := flag.String("forward", "", "comma-separated OTLP endpoints every received export request is forwarded to")
+	forwardQueueSize := flag.Int("forward-queue-size", forward.DefaultQueueSize, "number of export requests queued for each forwarding endpoint")
+	forwardCA := flag.String("forward-tls-ca", "", "connect to the forwarding endpoints over TLS, trusting these CAs (default: plaintext)")
+	snapshotAddress := flag.String("snapshot-address", "", "address accepting the models published by queue-scaler running inside collectors, with the TLS and tokens of the OTLP receiver (default: disabled)")
+	snapshotMaxAge := flag.Duration("snapshot-max-age", controller.DefaultMaxSnapshotAge, "how long the model of a collector that stopped publishing keeps counting")
+	zipkinAddress := flag.String("zipkin-address", "", "address accepting Zipkin v2 JSON spans (default: disabled)")
+	flag.Parse()
+
 	var wg sync.WaitGroup
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	ch := make(chan *receiver.Span)
-	recv := receiver.NewOLTPReceiver(receiver.WithChannel(ch))
+	ch := make(chan receiver.Batch, *bufferSize)
+	receiverOptions := []receiver.Option{
+		receiver.WithChannel(ch),
+		receiver.WithPolicy(policy),
+		receiver.WithStopTimeout(*stopTimeout),
+	}
+	if *reflection {
+		receiverOptions = append(receiverOptions, receiver.WithReflection())
+	}
+	metrics := make(chan *receiver.Metrics, *bufferSize)
+	if *acceptMetrics {
+		receiverOptions = append(receiverOptions, receiver.WithMetrics(metrics))
+	}
+	if *jaeger {
+		receiverOptions = append(receiverOptions, receiver.WithJaeger())
+	}
+	var tlsConfig *tls.Config
+	if *tlsCert != "" || *tlsKey != "" || *tlsClientCA != "" {
+		config, err := certs.ServerConfig(*tlsCert, *tlsKey, *tlsClientCA)
+		if err != nil {
+			log.Fatalf("failed to load TLS configuration: %v", err)
+		}
+		tlsConfig = config
+		receiverOptions = append(receiverOptions, receiver.WithTLS(config))
+	}
+	if *authTokens != "" {
+		var authOptions []receiver.AuthenticatorOption
+		if deployments, err := controller.NewDeployments(); err != nil {
+			log.Printf("grants by namespace only allow the wildcard outside of a cluster: %v", err)
+		} else {
+			authOptions = append(authOptions, receiver.WithDeployments(deployments.Contains))
+		}
+
+		auth, err := receiver.LoadAuthenticator(*authTokens, authOptions...)
+		if err != nil {
+			log.Fatalf("failed to load tokens: %v", err)
+		}
+		receiverOptions = append(receiverOptions, receiver.WithAuthenticator(auth))
+	}
+	var forwarders []*forward.Forwarder
+	for _, endpoint := range strings.Split(*forwardTo, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+			continue
+		}
+
+		forwardOptions := []forward.Option{forward.WithQueueSize(*forwardQueueSize)}
+		if *forwardCA != "" {
+			config, err := certs.ClientConfig(*forwardCA, "", "", "")
+			if err != nil {
+				log.Fatalf("failed to load TLS configuration: %v", err)
+			}
+			forwardOptions = append(forwardOptions,
+				forward.WithDialOptions(grpc.WithTransportCredentials(credentials.NewTLS(config))))
+		}
+
+		forwarder, err := forward.NewForwarder(endpoint, forwardOptions...)
+		if err != nil {
+			log.Fatalf("failed to forward to %s: %v", endpoint, err)
+		}
+		forwarders = append(forwarders, forwarder)
+		receiverOptions = append(receiverOptions, receiver.WithForwarder(forwarder))
+	}
+	recv := receiver.NewOLTPReceiver(receiverOptions...)
 
 	cont := controller.NewObserverState()
-	httpErr := make(chan error, 1)
+	controllers := []controller.CompositeOption{
+		controller.WithConcurrent(*concurrent),
+		controller.WithNamedController("state", cont),
+	}
+	if *scale {
+		weights := map[string]float64{}
+		if *serviceWeights != "" {
+			for _, entry := range strings.Split(*serviceWeights, ",") {
+				service, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+				weight, err := strconv.ParseFloat(value, 64)
+				if !ok || err != nil {
+					log.Fatalf("invalid service weight %q, expected service=weight", entry)
+				}
+				weights[service] = weight
+			}
+		}
+
+		objectives, err := queue.ParseSLOs(*slos)
+		if err != nil {
+			log.Fatalf("failed with error: %v", err)
+		}
+
+		kube, err := controller.NewKubeController(
+			controller.WithReplicaBudget(int32(*replicaBudget), weights),
+			controller.WithSLOs(objectives),
+			controller.WithMaxWaitingTime(*maxWaitingTime),
+			controller.WithMinSamples(*minSamples),
+			controller.WithMaxRelativeWidth(*maxRelativeWidth))
+		if err != nil {
+			log.Fatalf("failed with error: %v", err)
+		}
+		controllers = append(controllers, controller.WithNamedController("kubernetes", kube))
+	}
+	composite := controller.NewComposite(controllers...)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		io.WriteString(w, cont.State)
+		io.WriteString(w, cont.State())
+	})
+	mux.HandleFunc("GET /snapshot", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(cont.Snapshot())
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(composite.Status())
 	})
 	server := &http.Server{
 		Addr:    ":8080",
 		Handler: mux,
 	}
 
+	var writer *record.Writer
+	if *recordPath != "" {
+		file, err := os.Create(*recordPath)
+		if err != nil {
+			log.Fatalf("failed with error: %v", err)
+		}
+		defer file.Close()
+
+		writer = record.NewWriter(file)
+		defer writer.Flush()
+	}
+
+	// models published by queue-scaler running inside collectors are
+	// merged into the local one on every tick
+	var root controller.Controller = composite
+	var snapshots *http.Server
+	if *snapshotAddress != "" {
+		aggregatorOptions := []controller.AggregatorOption{controller.WithMaxSnapshotAge(*snapshotMaxAge)}
+		if writer != nil {
+			aggregatorOptions = append(aggregatorOptions, controller.WithSnapshotRecorder(writer))
+		}
+		aggregator := controller.NewAggregator(composite, aggregatorOptions...)
+		root = aggregator
+		snapshots = &http.Server{
+			Addr:      *snapshotAddress,
+			Handler:   recv.SnapshotHandler(aggregator.Accept),
+			TLSConfig: tlsConfig,
+		}
+	}
+
+	var zipkin *http.Server
+	if *zipkinAddress != "" {
+		zipkin = &http.Server{
+			Addr:      *zipkinAddress,
+			Handler:   recv.ZipkinHandler(),
+			TLSConfig: tlsConfig,
+		}
+	}
+
+	var receiverServers []*http.Server
+	for _, receiverServer := range []*http.Server{snapshots, zipkin} {
+		if receiverServer != nil {
+			receiverServers = append(receiverServers, receiverServer)
+		}
+	}
+	// every server sends once, also when shut down with nobody receiving
+	httpErr := make(chan error, 1+len(receiverServers))
+
 	_, recvErr := recv.Start()
 
+	var source scrape.Source
+	if *queuePrometheus != "" {
+		source = scrape.NewPrometheus(*queuePrometheus, *queueQuery, *queueLabel)
+	}
+	queueLengths := make(chan map[string]float64, 1)
+
+	options := []observer.Option{
+		observer.WithController(root),
+		observer.WithMetrics(metrics),
+		observer.WithQueueLengths(queueLengths, queueLengthIntervals*(*scrapeInterval)),
+		observer.WithShards(*shards),
+	}
+	if *lateness > 0 {
+		options = append(options, observer.WithEventTime(*lateness))
+	}
+	if writer != nil {
+		options = append(options, observer.WithRecorder(writer))
+	}
+
+	// the observer outlives the receiver so that in-flight exports drain
+	observeCtx, stopObserving := context.WithCancel(context.Background())
+	defer stopObserving()
+
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		obs := observer.NewObserver(observer.WithController(cont))
-		obs.Observe(ctx, ch)
+		obs := observer.NewObserver(options...)
+		recv.SetServing(true)
+		obs.Observe(observeCtx, ch)
 	}()
 	go func() {
 		defer wg.Done()
 		httpErr <- server.ListenAndServe()
 	}()
+	if source != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scrape.Run(observeCtx, source, *scrapeInterval, queueLengths)
+		}()
+	}
+	for _, receiverServer := range receiverServers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if tlsConfig != nil {
+				httpErr <- receiverServer.ListenAndServeTLS("", "")
+			} else {
+				httpErr <- receiverServer.ListenAndServe()
+			}
+		}()
+	}
 
 	select {
 	case err := <-recvErr:
@@ -59,7 +319,20 @@ func main() {
 		}
 
 	case <-ctx.Done():
+		for _, receiverServer := range receiverServers {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), *stopTimeout)
+			receiverServer.Shutdown(shutdownCtx)
+			cancel()
+		}
 		recv.Stop()
+		for _, forwarder := range forwarders {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), *stopTimeout)
+			if err := forwarder.Shutdown(shutdownCtx); err != nil {
+				log.Printf("forwarding to %s: %v", forwarder.Endpoint(), err)
+			}
+			cancel()
+		}
+		stopObserving()
 		server.Shutdown(ctx)
 	}
 
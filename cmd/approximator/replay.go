@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/pako-23/queue-scaler/internal/observer"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"github.com/pako-23/queue-scaler/internal/record"
+)
+
+func replay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	realtime := flags.Bool("realtime", false, "replay spans at the recorded pace through the observer loop")
+	interval := flags.Duration("interval", observer.DefaultInterval, "observer interval used by real time replays")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s replay [-realtime] [-interval duration] recording.jsonl\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := record.NewReader(file)
+	if !*realtime {
+		obs, err := record.Replay(reader, observer.WithInterval(*interval))
+		if err != nil {
+			return err
+		}
+		fmt.Println(obs.State.ToDOT())
+		return nil
+	}
+
+	obs := observer.NewObserver(observer.WithInterval(*interval))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ch := make(chan receiver.Batch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		obs.Observe(ctx, ch)
+	}()
+
+	err = record.Stream(ctx, reader, ch)
+	stop()
+	<-done
+	fmt.Println(obs.State.ToDOT())
+
+	return err
+}
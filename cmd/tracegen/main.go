@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/certs"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"github.com/pako-23/queue-scaler/internal/tracegen"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const exportTimeout = 10 * time.Second
+
+func main() {
+	address := flag.String("address", "localhost"+receiver.DefaultAddress, "address of the OTLP receiver")
+	topologyPath := flag.String("topology", "", "path to the JSON topology file")
+	spansPerSecond := flag.Float64("spans-per-second", 0, "target spans/sec (default: the arrival rate of the topology)")
+	batchSize := flag.Int("batch-size", 512, "maximum number of spans per export request")
+	flushInterval := flag.Duration("flush-interval", time.Second, "maximum time a span is buffered before being exported")
+	duration := flag.Duration("duration", 0, "how long to generate traffic (default: until interrupted)")
+	reorder := flag.Float64("reorder", 0, "probability that a span is delivered in a later batch")
+	dropParent := flag.Float64("drop-parent", 0, "probability that the root span of a trace is never delivered")
+	useTLS := flag.Bool("tls", false, "connect over TLS, verifying the receiver against the system roots")
+	tlsCA := flag.String("tls-ca", "", "CA file used to verify the receiver certificate (implies -tls)")
+	tlsCert := flag.String("tls-cert", "", "client certificate file for mutual TLS, reloaded on change (implies -tls)")
+	tlsKey := flag.String("tls-key", "", "client private key file for mutual TLS, reloaded on change")
+	tlsServerName := flag.String("tls-server-name", "", "server name expected in the receiver certificate (default: the host of -address)")
+	token := flag.String("token", "", "bearer token sent with every export request")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "random seed")
+	flag.Parse()
+
+	if *topologyPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	topology, err := tracegen.LoadTopology(*topologyPath)
+	if err != nil {
+		log.Fatalf("failed to load topology: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	transport := insecure.NewCredentials()
+	if *useTLS || *tlsCA != "" || *tlsCert != "" || *tlsKey != "" {
+		config, err := certs.ClientConfig(*tlsCA, *tlsCert, *tlsKey, *tlsServerName)
+		if err != nil {
+			log.Fatalf("failed to load TLS configuration: %v", err)
+		}
+		transport = credentials.NewTLS(config)
+	}
+
+	conn, err := grpc.NewClient(*address, grpc.WithTransportCredentials(transport))
+	if err != nil {
+		log.Fatalf("failed to connect to %s: %v", *address, err)
+	}
+	defer conn.Close()
+	client := coltracepb.NewTraceServiceClient(conn)
+
+	rate := topology.ArrivalRate()
+	if *spansPerSecond > 0 {
+		rate = *spansPerSecond / topology.ExpectedSpans()
+	}
+
+	generator, err := tracegen.NewGenerator(topology,
+		tracegen.WithSeed(*seed),
+		tracegen.WithReorder(*reorder),
+		tracegen.WithDropParent(*dropParent))
+	if err != nil {
+		log.Fatalf("invalid topology: %v", err)
+	}
+	rng := rand.New(rand.NewSource(*seed))
+
+	batch := make([]*tracegen.Span, 0, *batchSize)
+	sent, rejected := 0, int64(0)
+	flush := func() {
+		for len(batch) > 0 {
+			size := min(len(batch), *batchSize)
+
+			exportCtx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+			if *token != "" {
+				exportCtx = metadata.AppendToOutgoingContext(exportCtx, "authorization", "Bearer "+*token)
+			}
+			res, err := client.Export(exportCtx, tracegen.Request(batch[:size]))
+			cancel()
+			if err != nil {
+				log.Printf("export failed: %v", err)
+			} else if res.PartialSuccess != nil {
+				rejected += res.PartialSuccess.RejectedSpans
+			}
+			sent += size
+			batch = batch[size:]
+		}
+		batch = make([]*tracegen.Span, 0, *batchSize)
+	}
+
+	start := time.Now()
+	next := start
+	lastFlush := start
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flush()
+			elapsed := time.Since(start).Seconds()
+			log.Printf("sent %d spans in %.1fs (%.1f spans/s), %d rejected",
+				sent, elapsed, float64(sent)/elapsed, rejected)
+			return
+
+		case now := <-timer.C:
+			for !next.After(now) {
+				batch = append(batch, generator.Next(next)...)
+				next = next.Add(time.Duration(rng.ExpFloat64() / rate * float64(time.Second)))
+			}
+
+			if len(batch) >= *batchSize || now.Sub(lastFlush) >= *flushInterval {
+				flush()
+				lastFlush = now
+			}
+
+			timer.Reset(min(time.Until(next), time.Until(lastFlush.Add(*flushInterval))))
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+var ErrNoCertificates = errors.New("no certificates found")
+
+// fileVersion identifies the content of a set of files on disk by their
+// modification times and sizes.
+func fileVersion(files ...string) (string, error) {
+	version := ""
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		version += fmt.Sprintf("%s:%d:%d;", file, info.ModTime().UnixNano(), info.Size())
+	}
+
+	return version, nil
+}
+
+// KeyPair is a certificate and private key loaded from disk, reloaded
+// whenever either file changes.
+type KeyPair struct {
+	certFile string
+	cert     *tls.Certificate
+	keyFile  string
+	lock     sync.Mutex
+	version  string
+}
+
+func NewKeyPair(certFile string, keyFile string) (*KeyPair, error) {
+	pair := &KeyPair{certFile: certFile, keyFile: keyFile}
+	if _, err := pair.Certificate(); err != nil {
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Certificate returns the current certificate. If reloading fails, the
+// previously loaded certificate keeps being served.
+func (k *KeyPair) Certificate() (*tls.Certificate, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	version, err := fileVersion(k.certFile, k.keyFile)
+	if err == nil && version == k.version {
+		return k.cert, nil
+	}
+
+	var cert tls.Certificate
+	if err == nil {
+		cert, err = tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	}
+	if err != nil {
+		if k.cert != nil {
+			log.Printf("failed to reload certificate %s: %v", k.certFile, err)
+			return k.cert, nil
+		}
+
+		return nil, err
+	}
+
+	k.cert = &cert
+	k.version = version
+
+	return k.cert, nil
+}
+
+// Pool is a set of PEM encoded CA certificates loaded from disk, reloaded
+// whenever the file changes.
+type Pool struct {
+	file    string
+	lock    sync.Mutex
+	pool    *x509.CertPool
+	version string
+}
+
+func NewPool(file string) (*Pool, error) {
+	pool := &Pool{file: file}
+	if _, err := pool.CertPool(); err != nil {
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+func (p *Pool) CertPool() (*x509.CertPool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	version, err := fileVersion(p.file)
+	if err == nil && version == p.version {
+		return p.pool, nil
+	}
+
+	var data []byte
+	if err == nil {
+		data, err = os.ReadFile(p.file)
+	}
+
+	pool := x509.NewCertPool()
+	if err == nil && !pool.AppendCertsFromPEM(data) {
+		err = fmt.Errorf("%s: %w", p.file, ErrNoCertificates)
+	}
+	if err != nil {
+		if p.pool != nil {
+			log.Printf("failed to reload certificates %s: %v", p.file, err)
+			return p.pool, nil
+		}
+
+		return nil, err
+	}
+
+	p.pool = pool
+	p.version = version
+
+	return p.pool, nil
+}
+
+// ServerConfig returns a TLS configuration serving the given key pair. When
+// clientCAFile is not empty, clients must present a certificate signed by one
+// of its CAs. All the files are reloaded on change.
+func ServerConfig(certFile string, keyFile string, clientCAFile string) (*tls.Config, error) {
+	pair, err := NewKeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return pair.Certificate()
+		},
+	}
+	if clientCAFile == "" {
+		return config, nil
+	}
+
+	clientCAs, err := NewPool(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		pool, err := clientCAs.CertPool()
+		if err != nil {
+			return nil, err
+		}
+
+		current := config.Clone()
+		current.GetConfigForClient = nil
+		current.ClientAuth = tls.RequireAndVerifyClientCert
+		current.ClientCAs = pool
+
+		return current, nil
+	}
+
+	return config, nil
+}
+
+// ClientConfig returns a TLS configuration verifying the server against the
+// CAs in caFile, or the system roots if caFile is empty. When certFile and
+// keyFile are not empty, the key pair is presented to the server and
+// reloaded on change.
+func ClientConfig(caFile string, certFile string, keyFile string, serverName string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+
+	if caFile != "" {
+		pool, err := NewPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool.pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		pair, err := NewKeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return pair.Certificate()
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,269 @@
+package certs_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/certs"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"gotest.tools/v3/assert"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func writePEM(t *testing.T, path string, kind string, data []byte) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	assert.NilError(t, err)
+	defer file.Close()
+	assert.NilError(t, pem.Encode(file, &pem.Block{Type: kind, Bytes: data}))
+}
+
+func newAuthority(t *testing.T, path string) *authority {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		NotAfter:              time.Now().Add(time.Hour),
+		NotBefore:             time.Now().Add(-time.Hour),
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test authority"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NilError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NilError(t, err)
+	writePEM(t, path, "CERTIFICATE", der)
+
+	return &authority{cert: cert, key: key}
+}
+
+func (a *authority) issue(t *testing.T, serial int64, certFile string, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	template := &x509.Certificate{
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		NotAfter:     time.Now().Add(time.Hour),
+		NotBefore:    time.Now().Add(-time.Hour),
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	assert.NilError(t, err)
+	writePEM(t, certFile, "CERTIFICATE", der)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+
+	// make sure the change is visible even on coarse file system clocks
+	modified := time.Now().Add(time.Duration(serial) * time.Second)
+	assert.NilError(t, os.Chtimes(certFile, modified, modified))
+	assert.NilError(t, os.Chtimes(keyFile, modified, modified))
+}
+
+type testFiles struct {
+	ca, serverCert, serverKey, clientCert, clientKey string
+}
+
+func newTestFiles(t *testing.T) (*testFiles, *authority) {
+	dir := t.TempDir()
+	files := &testFiles{
+		ca:         filepath.Join(dir, "ca.pem"),
+		serverCert: filepath.Join(dir, "server.pem"),
+		serverKey:  filepath.Join(dir, "server-key.pem"),
+		clientCert: filepath.Join(dir, "client.pem"),
+		clientKey:  filepath.Join(dir, "client-key.pem"),
+	}
+
+	ca := newAuthority(t, files.ca)
+	ca.issue(t, 2, files.serverCert, files.serverKey)
+	ca.issue(t, 3, files.clientCert, files.clientKey)
+
+	return files, ca
+}
+
+// handshake serves a single TLS connection and returns the serial number of
+// the certificate presented by the server.
+func handshake(t *testing.T, server *tls.Config, client *tls.Config) (int64, error) {
+	t.Helper()
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	assert.NilError(t, err)
+	defer lis.Close()
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	// client certificate failures surface on the first read, while a
+	// successful handshake is followed by the server closing the connection
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	files, _ := newTestFiles(t)
+	server, err := certs.ServerConfig(files.serverCert, files.serverKey, files.ca)
+	assert.NilError(t, err)
+
+	client, err := certs.ClientConfig(files.ca, files.clientCert, files.clientKey, "localhost")
+	assert.NilError(t, err)
+	serial, err := handshake(t, server, client)
+	assert.NilError(t, err)
+	assert.Equal(t, int64(2), serial)
+
+	anonymous, err := certs.ClientConfig(files.ca, "", "", "localhost")
+	assert.NilError(t, err)
+	_, err = handshake(t, server, anonymous)
+	assert.Assert(t, err != nil)
+}
+
+func TestServerOnlyTLS(t *testing.T) {
+	t.Parallel()
+
+	files, _ := newTestFiles(t)
+	server, err := certs.ServerConfig(files.serverCert, files.serverKey, "")
+	assert.NilError(t, err)
+
+	client, err := certs.ClientConfig(files.ca, "", "", "localhost")
+	assert.NilError(t, err)
+	_, err = handshake(t, server, client)
+	assert.NilError(t, err)
+
+	untrusted, err := certs.ClientConfig("", "", "", "localhost")
+	assert.NilError(t, err)
+	_, err = handshake(t, server, untrusted)
+	assert.Assert(t, err != nil)
+}
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	files, ca := newTestFiles(t)
+	server, err := certs.ServerConfig(files.serverCert, files.serverKey, files.ca)
+	assert.NilError(t, err)
+	client, err := certs.ClientConfig(files.ca, files.clientCert, files.clientKey, "localhost")
+	assert.NilError(t, err)
+
+	ca.issue(t, 4, files.serverCert, files.serverKey)
+	serial, err := handshake(t, server, client)
+	assert.NilError(t, err)
+	assert.Equal(t, int64(4), serial)
+
+	// a broken certificate keeps the previous one in use
+	assert.NilError(t, os.WriteFile(files.serverCert, []byte("garbage"), 0o600))
+	serial, err = handshake(t, server, client)
+	assert.NilError(t, err)
+	assert.Equal(t, int64(4), serial)
+
+	// rotating the client CA rejects clients signed by the old one
+	newAuthority(t, files.ca)
+	modified := time.Now().Add(time.Minute)
+	assert.NilError(t, os.Chtimes(files.ca, modified, modified))
+	ca.issue(t, 5, files.serverCert, files.serverKey)
+	_, err = handshake(t, server, client)
+	assert.Assert(t, err != nil)
+}
+
+func TestInvalidFiles(t *testing.T) {
+	t.Parallel()
+
+	files, _ := newTestFiles(t)
+
+	_, err := certs.ServerConfig(files.serverCert, files.clientKey, "")
+	assert.Assert(t, err != nil)
+
+	_, err = certs.ServerConfig(files.serverCert, files.serverKey, files.serverKey)
+	assert.ErrorIs(t, err, certs.ErrNoCertificates)
+
+	_, err = certs.ClientConfig(filepath.Join(t.TempDir(), "missing.pem"), "", "", "")
+	assert.Assert(t, err != nil)
+}
+
+func TestReceiverTLS(t *testing.T) {
+	t.Parallel()
+
+	files, _ := newTestFiles(t)
+	server, err := certs.ServerConfig(files.serverCert, files.serverKey, files.ca)
+	assert.NilError(t, err)
+
+	ch := make(chan receiver.Batch, 1)
+	recv := receiver.NewOLTPReceiver(
+		receiver.WithAddress("127.0.0.1:0"),
+		receiver.WithChannel(ch),
+		receiver.WithTLS(server))
+	lis, _ := recv.Start()
+	assert.Assert(t, lis != nil)
+	defer recv.Stop()
+
+	export := func(config *tls.Config) error {
+		conn, err := grpc.NewClient(lis.Addr().String(),
+			grpc.WithTransportCredentials(credentials.NewTLS(config)))
+		assert.NilError(t, err)
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = coltracepb.NewTraceServiceClient(conn).Export(ctx, &coltracepb.ExportTraceServiceRequest{})
+
+		return err
+	}
+
+	client, err := certs.ClientConfig(files.ca, files.clientCert, files.clientKey, "localhost")
+	assert.NilError(t, err)
+	assert.NilError(t, export(client))
+
+	anonymous, err := certs.ClientConfig(files.ca, "", "", "localhost")
+	assert.NilError(t, err)
+	assert.Assert(t, export(anonymous) != nil)
+}
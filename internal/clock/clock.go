@@ -0,0 +1,29 @@
+package clock
+
+import "time"
+
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+type Clock interface {
+	Now() time.Time
+	NewTicker(time.Duration) Ticker
+}
+
+type Real struct{}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (r *realTicker) C() <-chan time.Time { return r.ticker.C }
+
+func (r *realTicker) Stop() { r.ticker.Stop() }
+
+func (Real) Now() time.Time { return time.Now() }
+
+func (Real) NewTicker(interval time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(interval)}
+}
@@ -0,0 +1,55 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/clock"
+	"gotest.tools/v3/assert"
+)
+
+func TestRealClock(t *testing.T) {
+	t.Parallel()
+
+	var clk clock.Clock = clock.Real{}
+
+	before := time.Now()
+	assert.Assert(t, !clk.Now().Before(before))
+
+	ticker := clk.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	select {
+	case <-ticker.C():
+	case <-time.After(time.Second):
+		t.Fatal("the real ticker never fired")
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+	fake := clock.NewFake(start)
+	assert.Assert(t, fake.Now().Equal(start))
+
+	ticker := fake.NewTicker(time.Second)
+
+	fake.Advance(500 * time.Millisecond)
+	assert.Assert(t, fake.Now().Equal(start.Add(500*time.Millisecond)))
+	assert.Equal(t, 0, len(ticker.C()))
+
+	fake.Advance(500 * time.Millisecond)
+	assert.Equal(t, 1, len(ticker.C()))
+	assert.Assert(t, (<-ticker.C()).Equal(start.Add(time.Second)))
+
+	fake.Advance(10 * time.Second)
+	assert.Equal(t, 1, len(ticker.C()))
+	assert.Assert(t, (<-ticker.C()).Equal(start.Add(2*time.Second)))
+
+	fake.Set(start)
+	assert.Assert(t, fake.Now().Equal(start.Add(11*time.Second)))
+
+	ticker.Stop()
+	fake.Advance(10 * time.Second)
+	assert.Equal(t, 0, len(ticker.C()))
+}
@@ -0,0 +1,86 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+type fakeTicker struct {
+	ch       chan time.Time
+	clock    *Fake
+	interval time.Duration
+	next     time.Time
+}
+
+func (f *fakeTicker) C() <-chan time.Time { return f.ch }
+
+func (f *fakeTicker) Stop() {
+	f.clock.mu.Lock()
+	defer f.clock.mu.Unlock()
+
+	delete(f.clock.tickers, f)
+}
+
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers map[*fakeTicker]struct{}
+}
+
+func NewFake(start time.Time) *Fake {
+	return &Fake{
+		now:     start,
+		tickers: map[*fakeTicker]struct{}{},
+	}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) NewTicker(interval time.Duration) Ticker {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ticker := &fakeTicker{
+		ch:       make(chan time.Time, 1),
+		clock:    f,
+		interval: interval,
+		next:     f.now.Add(interval),
+	}
+	f.tickers[ticker] = struct{}{}
+
+	return ticker
+}
+
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now.Before(f.now) {
+		return
+	}
+	f.now = now
+
+	for ticker := range f.tickers {
+		if ticker.next.After(now) {
+			continue
+		}
+
+		select {
+		case ticker.ch <- ticker.next:
+		default:
+		}
+
+		for !ticker.next.After(now) {
+			ticker.next = ticker.next.Add(ticker.interval)
+		}
+	}
+}
+
+func (f *Fake) Advance(elapsed time.Duration) {
+	f.Set(f.Now().Add(elapsed))
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/clock"
+	"github.com/pako-23/queue-scaler/internal/queue"
+)
+
+// DefaultMaxSnapshotAge is how long the snapshot of a publisher that stopped
+// publishing keeps counting.
+const DefaultMaxSnapshotAge = time.Minute
+
+type publishedSnapshot struct {
+	published time.Time
+	state     *queue.QueueNetwork
+}
+
+// Aggregator keeps the latest snapshot published by every remote instance.
+// On every local tick, it merges them into the local state and hands the
+// result to its controller, so that the models of collectors observing
+// different requests are stabilized together.
+type Aggregator struct {
+	clock      clock.Clock
+	controller Controller
+	lock       sync.Mutex
+	maxAge     time.Duration
+	recorder   SnapshotRecorder
+	snapshots  map[string]*publishedSnapshot
+}
+
+// SnapshotRecorder records the snapshots accepted from publishers, after
+// leaving out the services they were not granted, with how long they count.
+type SnapshotRecorder interface {
+	RecordSnapshot(at time.Time, publisher string, snapshot json.RawMessage, maxAge time.Duration) error
+}
+
+type AggregatorOption func(*Aggregator)
+
+func NewAggregator(cont Controller, options ...AggregatorOption) *Aggregator {
+	aggregator := &Aggregator{
+		clock:      clock.Real{},
+		controller: cont,
+		maxAge:     DefaultMaxSnapshotAge,
+		snapshots:  map[string]*publishedSnapshot{},
+	}
+
+	for _, opt := range options {
+		opt(aggregator)
+	}
+
+	return aggregator
+}
+
+func WithAggregatorClock(clk clock.Clock) AggregatorOption {
+	return func(aggregator *Aggregator) {
+		aggregator.clock = clk
+	}
+}
+
+// WithMaxSnapshotAge drops the snapshot of a publisher that has not
+// published for longer than age.
+func WithMaxSnapshotAge(age time.Duration) AggregatorOption {
+	return func(aggregator *Aggregator) {
+		aggregator.maxAge = age
+	}
+}
+
+func WithSnapshotRecorder(recorder SnapshotRecorder) AggregatorOption {
+	return func(aggregator *Aggregator) {
+		aggregator.recorder = recorder
+	}
+}
+
+// Accept replaces the snapshot of publisher, keeping only what was observed
+// at the services allows accepts.
+func (a *Aggregator) Accept(publisher string, allows func(service string) bool, snapshot json.RawMessage) error {
+	state := queue.NewQueueNetwork()
+	if err := json.Unmarshal(snapshot, state); err != nil {
+		return err
+	}
+	state.Restrict(allows)
+	now := a.clock.Now()
+
+	if a.recorder != nil {
+		restricted, err := json.Marshal(state)
+		if err == nil {
+			err = a.recorder.RecordSnapshot(now, publisher, restricted, a.maxAge)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.snapshots[publisher] = &publishedSnapshot{
+		published: now,
+		state:     state,
+	}
+
+	return nil
+}
+
+func (a *Aggregator) Stabilize(state *queue.QueueNetwork) error {
+	merged := state.Clone()
+
+	a.lock.Lock()
+	now := a.clock.Now()
+	for publisher, snapshot := range a.snapshots {
+		if now.Sub(snapshot.published) > a.maxAge {
+			delete(a.snapshots, publisher)
+			continue
+		}
+		merged.Merge(snapshot.state)
+	}
+	a.lock.Unlock()
+
+	return a.controller.Stabilize(merged)
+}
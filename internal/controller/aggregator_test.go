@@ -0,0 +1,84 @@
+package controller_test
+
+import (
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/clock"
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+type latestController struct {
+	state *queue.QueueNetwork
+}
+
+func (l *latestController) Stabilize(state *queue.QueueNetwork) error {
+	l.state = state
+	return nil
+}
+
+func requests(counts map[string]int) *queue.QueueNetwork {
+	state := queue.NewQueueNetwork()
+	for service, count := range counts {
+		for i := 0; i < count; i++ {
+			state.AddExternalRequest(&receiver.Span{Duration: 1000, ServiceName: service})
+		}
+	}
+	state.UpdateEstimates(time.Second)
+
+	return state
+}
+
+func TestAggregator(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	latest := &latestController{}
+	aggregator := controller.NewAggregator(latest,
+		controller.WithAggregatorClock(clk),
+		controller.WithMaxSnapshotAge(time.Minute))
+
+	recv := receiver.NewOLTPReceiver(receiver.WithAuthenticator(receiver.NewAuthenticator(map[string]*receiver.Grant{
+		"frontend-token": {Services: []string{"frontend"}},
+		"admin-token":    {Services: []string{"*"}},
+	})))
+	server := httptest.NewServer(recv.SnapshotHandler(aggregator.Accept))
+	defer server.Close()
+	url := server.URL + receiver.SnapshotPath
+
+	count := func(service string) uint64 {
+		assert.NilError(t, aggregator.Stabilize(requests(map[string]int{"frontend": 5})))
+		if histogram := latest.state.Histogram(service); histogram != nil {
+			return histogram.Count()
+		}
+		return 0
+	}
+
+	first := controller.NewPublisher(url, controller.WithPublisherName("first"), controller.WithToken("frontend-token"))
+	second := controller.NewPublisher(url, controller.WithPublisherName("second"), controller.WithToken("admin-token"))
+
+	// backend is not granted to the first publisher
+	assert.NilError(t, first.Stabilize(requests(map[string]int{"backend": 5, "frontend": 10})))
+	assert.NilError(t, second.Stabilize(requests(map[string]int{"frontend": 30})))
+	assert.Equal(t, count("frontend"), uint64(5+10+30))
+	assert.Equal(t, count("backend"), uint64(0))
+	assert.Assert(t, math.Abs(latest.state.ExternalRates()["frontend"]-0.8*45) < 10e-9)
+
+	// snapshots replace the previous ones of the same publisher
+	assert.NilError(t, first.Stabilize(requests(map[string]int{"frontend": 20})))
+	assert.Equal(t, count("frontend"), uint64(5+20+30))
+
+	// the first publisher stopped publishing
+	clk.Advance(50 * time.Second)
+	assert.NilError(t, second.Stabilize(requests(map[string]int{"frontend": 30})))
+	clk.Advance(20 * time.Second)
+	assert.Equal(t, count("frontend"), uint64(5+30))
+
+	anonymous := controller.NewPublisher(url)
+	assert.ErrorContains(t, anonymous.Stabilize(requests(nil)), "401")
+}
@@ -1,19 +1,55 @@
 package controller
 
-import "github.com/pako-23/queue-scaler/internal/queue"
+import (
+	"encoding/json"
+	"sync/atomic"
 
+	"github.com/pako-23/queue-scaler/internal/queue"
+)
+
+type observedState struct {
+	dot      string
+	snapshot []byte
+}
+
+// ObserverState keeps the latest state it was given for the HTTP endpoints,
+// which read it while the observer stabilizes the next one.
 type ObserverState struct {
-	State string
+	latest atomic.Pointer[observedState]
 }
 
 func NewObserverState() *ObserverState {
-	return &ObserverState{
-		State: queue.NewQueueNetwork().ToDOT(),
-	}
+	state := queue.NewQueueNetwork()
+	snapshot, _ := json.Marshal(state)
+
+	observer := &ObserverState{}
+	observer.latest.Store(&observedState{
+		dot:      state.ToDOT(),
+		snapshot: snapshot,
+	})
 
+	return observer
 }
 
 func (o *ObserverState) Stabilize(state *queue.QueueNetwork) error {
-	o.State = state.ToDOT()
+	snapshot, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	o.latest.Store(&observedState{
+		dot:      state.ToDOT(),
+		snapshot: snapshot,
+	})
 	return nil
 }
+
+// Snapshot returns the latest state as JSON.
+func (o *ObserverState) Snapshot() []byte {
+	return o.latest.Load().snapshot
+}
+
+// State returns the latest state in DOT.
+func (o *ObserverState) State() string {
+	return o.latest.Load().dot
+}
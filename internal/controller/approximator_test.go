@@ -0,0 +1,53 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestObserverState(t *testing.T) {
+	t.Parallel()
+
+	cont := controller.NewObserverState()
+	assert.Equal(t, cont.State(), queue.NewQueueNetwork().ToDOT())
+
+	state := queue.NewQueueNetwork()
+	state.AddExternalRequest(&receiver.Span{Duration: 100, ServiceName: "frontend", SpanId: "1"})
+	assert.NilError(t, cont.Stabilize(state))
+
+	expected, err := json.Marshal(state)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, cont.Snapshot(), expected)
+	assert.Equal(t, cont.State(), state.ToDOT())
+}
+
+func TestObserverStateConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	cont := controller.NewObserverState()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			state := queue.NewQueueNetwork()
+			state.AddExternalRequest(&receiver.Span{Duration: uint64(i), ServiceName: "frontend"})
+			assert.Check(t, cont.Stabilize(state))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.Check(t, len(cont.Snapshot()) > 0)
+			assert.Check(t, cont.State() != "")
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/queue"
+)
+
+type ControllerStatus struct {
+	Duration  time.Duration `json:"duration"`
+	LastError string        `json:"lastError,omitempty"`
+	LastRun   time.Time     `json:"lastRun"`
+	Name      string        `json:"name"`
+}
+
+type namedController struct {
+	controller Controller
+	name       string
+}
+
+// Composite forwards every state to a list of controllers. A failing
+// controller does not prevent the others from running. Concurrent calls to
+// Stabilize are serialized.
+type Composite struct {
+	concurrent  bool
+	controllers []namedController
+	lock        sync.Mutex
+	stabilizing sync.Mutex
+	status      []ControllerStatus
+}
+
+type CompositeOption func(*Composite)
+
+func NewComposite(options ...CompositeOption) *Composite {
+	composite := &Composite{
+		concurrent:  false,
+		controllers: []namedController{},
+	}
+
+	for _, opt := range options {
+		opt(composite)
+	}
+
+	composite.status = make([]ControllerStatus, len(composite.controllers))
+	for i, cont := range composite.controllers {
+		composite.status[i].Name = cont.name
+	}
+
+	return composite
+}
+
+func WithNamedController(name string, cont Controller) CompositeOption {
+	return func(composite *Composite) {
+		composite.controllers = append(composite.controllers, namedController{
+			controller: cont,
+			name:       name,
+		})
+	}
+}
+
+func WithConcurrent(concurrent bool) CompositeOption {
+	return func(composite *Composite) {
+		composite.concurrent = concurrent
+	}
+}
+
+func (c *Composite) run(index int, state *queue.QueueNetwork) (err error) {
+	cont := c.controllers[index]
+	start := time.Now()
+
+	defer func() {
+		if value := recover(); value != nil {
+			err = fmt.Errorf("panic: %v", value)
+		}
+
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		c.status[index].Duration = time.Since(start)
+		c.status[index].LastRun = start
+		c.status[index].LastError = ""
+		if err != nil {
+			c.status[index].LastError = err.Error()
+			err = fmt.Errorf("controller %s: %w", cont.name, err)
+		}
+	}()
+
+	return cont.controller.Stabilize(state)
+}
+
+func (c *Composite) Stabilize(state *queue.QueueNetwork) error {
+	c.stabilizing.Lock()
+	defer c.stabilizing.Unlock()
+
+	errs := make([]error, len(c.controllers))
+
+	if !c.concurrent {
+		for i := range c.controllers {
+			errs[i] = c.run(i, state)
+		}
+
+		return errors.Join(errs...)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := range c.controllers {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			errs[index] = c.run(index, state)
+		}(i)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (c *Composite) Status() []ControllerStatus {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	status := make([]ControllerStatus, len(c.status))
+	copy(status, c.status)
+
+	return status
+}
@@ -0,0 +1,90 @@
+package controller_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"gotest.tools/v3/assert"
+)
+
+var errStabilize = errors.New("stabilize failed")
+
+type countingController struct {
+	calls atomic.Int32
+	delay time.Duration
+	err   error
+	panic bool
+}
+
+func (c *countingController) Stabilize(*queue.QueueNetwork) error {
+	c.calls.Add(1)
+	time.Sleep(c.delay)
+	if c.panic {
+		panic("broken controller")
+	}
+
+	return c.err
+}
+
+func TestComposite(t *testing.T) {
+	t.Parallel()
+
+	for _, concurrent := range []bool{false, true} {
+		failing := &countingController{err: errStabilize}
+		panicking := &countingController{panic: true}
+		working := &countingController{delay: 10 * time.Millisecond}
+
+		composite := controller.NewComposite(
+			controller.WithConcurrent(concurrent),
+			controller.WithNamedController("failing", failing),
+			controller.WithNamedController("panicking", panicking),
+			controller.WithNamedController("working", working))
+
+		err := composite.Stabilize(queue.NewQueueNetwork())
+		assert.ErrorIs(t, err, errStabilize)
+		assert.ErrorContains(t, err, "controller failing")
+		assert.ErrorContains(t, err, "controller panicking: panic: broken controller")
+		assert.Equal(t, int32(1), failing.calls.Load())
+		assert.Equal(t, int32(1), panicking.calls.Load())
+		assert.Equal(t, int32(1), working.calls.Load())
+
+		status := composite.Status()
+		assert.Equal(t, 3, len(status))
+		assert.Equal(t, "failing", status[0].Name)
+		assert.Equal(t, errStabilize.Error(), status[0].LastError)
+		assert.Equal(t, "panic: broken controller", status[1].LastError)
+		assert.Equal(t, "", status[2].LastError)
+		assert.Assert(t, status[2].Duration >= 10*time.Millisecond)
+		assert.Assert(t, !status[2].LastRun.IsZero())
+	}
+}
+
+func TestCompositeConcurrent(t *testing.T) {
+	t.Parallel()
+
+	slow := []*countingController{
+		{delay: 100 * time.Millisecond},
+		{delay: 100 * time.Millisecond},
+		{delay: 100 * time.Millisecond},
+	}
+	options := []controller.CompositeOption{controller.WithConcurrent(true)}
+	for _, cont := range slow {
+		options = append(options, controller.WithNamedController("slow", cont))
+	}
+
+	start := time.Now()
+	assert.NilError(t, controller.NewComposite(options...).Stabilize(queue.NewQueueNetwork()))
+	assert.Assert(t, time.Since(start) < 250*time.Millisecond)
+}
+
+func TestCompositeEmpty(t *testing.T) {
+	t.Parallel()
+
+	composite := controller.NewComposite()
+	assert.NilError(t, composite.Stabilize(queue.NewQueueNetwork()))
+	assert.Equal(t, 0, len(composite.Status()))
+}
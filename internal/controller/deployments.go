@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/clock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// DefaultDeploymentsRefresh is how long the deployments listed in a
+	// namespace are trusted, or a failure to list them remembered, before
+	// being listed again.
+	DefaultDeploymentsRefresh = time.Minute
+
+	// deploymentsListTimeout bounds a single listing of the deployments of
+	// a namespace.
+	deploymentsListTimeout = 5 * time.Second
+)
+
+type listedDeployments struct {
+	// attempted is when the deployments were last listed, successfully or
+	// not.
+	attempted time.Time
+	// listing is closed once the listing in progress, if any, completes.
+	listing chan struct{}
+	names   map[string]struct{}
+}
+
+// Deployments tells which deployments live in each namespace of a cluster,
+// so that grants by namespace can be checked against the services reported.
+type Deployments struct {
+	client     kubernetes.Interface
+	clock      clock.Clock
+	lock       sync.Mutex
+	namespaces map[string]*listedDeployments
+	refresh    time.Duration
+}
+
+type DeploymentsOption func(*Deployments)
+
+func WithDeploymentsClock(clk clock.Clock) DeploymentsOption {
+	return func(d *Deployments) {
+		d.clock = clk
+	}
+}
+
+func WithDeploymentsRefresh(refresh time.Duration) DeploymentsOption {
+	return func(d *Deployments) {
+		d.refresh = refresh
+	}
+}
+
+func NewDeployments(options ...DeploymentsOption) (*Deployments, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewDeploymentsFromClient(clientset, options...), nil
+}
+
+func NewDeploymentsFromClient(client kubernetes.Interface, options ...DeploymentsOption) *Deployments {
+	deployments := &Deployments{
+		client:     client,
+		clock:      clock.Real{},
+		namespaces: map[string]*listedDeployments{},
+		refresh:    DefaultDeploymentsRefresh,
+	}
+	for _, option := range options {
+		option(deployments)
+	}
+
+	return deployments
+}
+
+// Contains reports whether namespace holds a deployment named service. A
+// single caller lists the deployments again once the previous attempt is
+// older than the refresh period, without holding up the others, which keep
+// using the previous list. Only the callers asking about a namespace never
+// listed before wait for its first listing.
+func (d *Deployments) Contains(namespace string, service string) bool {
+	d.lock.Lock()
+	listed, ok := d.namespaces[namespace]
+	if !ok {
+		listed = &listedDeployments{}
+		d.namespaces[namespace] = listed
+	}
+
+	if listed.listing == nil && (listed.attempted.IsZero() || d.clock.Now().Sub(listed.attempted) >= d.refresh) {
+		listed.attempted = d.clock.Now()
+		listed.listing = make(chan struct{})
+		d.lock.Unlock()
+
+		names, err := d.list(namespace)
+
+		d.lock.Lock()
+		if err != nil {
+			log.Printf("failed to list the deployments of namespace '%s': %v\n", namespace, err)
+		} else {
+			listed.names = names
+		}
+		close(listed.listing)
+		listed.listing = nil
+	} else if listing := listed.listing; listing != nil && listed.names == nil {
+		d.lock.Unlock()
+		<-listing
+		d.lock.Lock()
+	}
+	defer d.lock.Unlock()
+
+	_, ok = listed.names[service]
+
+	return ok
+}
+
+func (d *Deployments) list(namespace string) (map[string]struct{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), deploymentsListTimeout)
+	defer cancel()
+
+	deployments, err := d.client.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{}, len(deployments.Items))
+	for _, deploy := range deployments.Items {
+		names[deploy.Name] = struct{}{}
+	}
+
+	return names, nil
+}
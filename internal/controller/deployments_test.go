@@ -0,0 +1,102 @@
+package controller_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/clock"
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"gotest.tools/v3/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestDeployments(t *testing.T) {
+	t.Parallel()
+
+	deployments := controller.NewDeploymentsFromClient(fake.NewSimpleClientset(
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cart", Namespace: "shop"}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "ledger", Namespace: "bank"}},
+	))
+
+	assert.Assert(t, deployments.Contains("shop", "cart"))
+	assert.Assert(t, !deployments.Contains("shop", "ledger"))
+	assert.Assert(t, deployments.Contains("bank", "ledger"))
+	assert.Assert(t, !deployments.Contains("default", "cart"))
+}
+
+func TestDeploymentsRefresh(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cart", Namespace: "shop"}})
+	var lists atomic.Int32
+	var failing atomic.Bool
+	client.PrependReactor("list", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		lists.Add(1)
+		if failing.Load() {
+			return true, nil, errors.New("unavailable")
+		}
+		return false, nil, nil
+	})
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	deployments := controller.NewDeploymentsFromClient(client,
+		controller.WithDeploymentsClock(clk),
+		controller.WithDeploymentsRefresh(time.Minute))
+
+	assert.Assert(t, deployments.Contains("shop", "cart"))
+	assert.Assert(t, deployments.Contains("shop", "cart"))
+	assert.Equal(t, lists.Load(), int32(1))
+
+	// failures keep the previous list and are not retried before the refresh
+	failing.Store(true)
+	clk.Advance(time.Minute)
+	assert.Assert(t, deployments.Contains("shop", "cart"))
+	assert.Assert(t, deployments.Contains("shop", "cart"))
+	assert.Equal(t, lists.Load(), int32(2))
+
+	assert.Assert(t, !deployments.Contains("bank", "ledger"))
+	assert.Assert(t, !deployments.Contains("bank", "ledger"))
+	assert.Equal(t, lists.Load(), int32(3))
+
+	clk.Advance(time.Minute)
+	assert.Assert(t, !deployments.Contains("bank", "ledger"))
+	assert.Equal(t, lists.Load(), int32(4))
+}
+
+func TestDeploymentsConcurrentRefresh(t *testing.T) {
+	t.Parallel()
+
+	client := fake.NewSimpleClientset(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cart", Namespace: "shop"}})
+	var lists atomic.Int32
+	release := make(chan struct{})
+	client.PrependReactor("list", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if lists.Add(1) > 1 {
+			<-release
+		}
+		return false, nil, nil
+	})
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	deployments := controller.NewDeploymentsFromClient(client, controller.WithDeploymentsClock(clk))
+	assert.Assert(t, deployments.Contains("shop", "cart"))
+
+	// while one caller lists again, the others use the previous list
+	clk.Advance(controller.DefaultDeploymentsRefresh)
+	done := make(chan bool)
+	go func() { done <- deployments.Contains("shop", "cart") }()
+	for lists.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		assert.Assert(t, deployments.Contains("shop", "cart"))
+	}
+	close(release)
+	assert.Assert(t, <-done)
+	assert.Equal(t, lists.Load(), int32(2))
+}
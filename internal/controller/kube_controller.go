@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"time"
 
 	"github.com/pako-23/queue-scaler/internal/queue"
 	apiv1 "k8s.io/api/core/v1"
@@ -20,6 +21,10 @@ const (
 	scaleDownsThreshold       = 30
 	maxReplicas         int32 = 20
 	minReplicas         int32 = 1
+
+	// queueLengthTolerance is how many more requests than predicted may be
+	// observed at a service before it is scaled up ahead of the model.
+	queueLengthTolerance = 1.0
 )
 
 type deployment struct {
@@ -29,13 +34,66 @@ type deployment struct {
 }
 
 type KubeController struct {
-	client      cliv1.DeploymentInterface
-	state       map[string]*deployment
-	minReplicas int32
-	maxReplicas int32
+	client           cliv1.DeploymentInterface
+	state            map[string]*deployment
+	maxRelativeWidth float64
+	maxWaitingTime   time.Duration
+	minReplicas      int32
+	maxReplicas      int32
+	minSamples       uint64
+	replicaBudget    int32
+	slos             map[string]queue.SLO
+	weights          map[string]float64
+}
+
+type KubeControllerOption func(*KubeController)
+
+// WithReplicaBudget caps the replicas of all the deployments together. When
+// services need more, the budget is shared to minimize the end-to-end
+// response time of the entry points, weighted by weights.
+func WithReplicaBudget(budget int32, weights map[string]float64) KubeControllerOption {
+	return func(k *KubeController) {
+		k.replicaBudget = budget
+		k.weights = weights
+	}
+}
+
+// WithSLOs also adds replicas to every service visited by the entry points
+// with an SLO until the predicted time its requests wait fits the share of
+// the SLO slack it is given. SLOs that cannot be met are only logged.
+func WithSLOs(slos map[string]queue.SLO) KubeControllerOption {
+	return func(k *KubeController) {
+		k.slos = slos
+	}
+}
+
+// WithMinSamples keeps the replicas of a service unchanged by the model while
+// its arrival rate or service time are based on fewer than samples requests.
+func WithMinSamples(samples uint64) KubeControllerOption {
+	return func(k *KubeController) {
+		k.minSamples = samples
+	}
+}
+
+// WithMaxRelativeWidth keeps the replicas of a service unchanged by the model
+// while the 95% confidence interval of its arrival rate or service time is
+// wider than width times the estimate.
+func WithMaxRelativeWidth(width float64) KubeControllerOption {
+	return func(k *KubeController) {
+		k.maxRelativeWidth = width
+	}
+}
+
+// WithMaxWaitingTime also adds replicas to a service until the mean time its
+// requests wait before being served is at most wait, as predicted by the
+// M/G/c model using the measured variability of its service times.
+func WithMaxWaitingTime(wait time.Duration) KubeControllerOption {
+	return func(k *KubeController) {
+		k.maxWaitingTime = wait
+	}
 }
 
-func NewKubeController() (*KubeController, error) {
+func NewKubeController(options ...KubeControllerOption) (*KubeController, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, err
@@ -46,11 +104,18 @@ func NewKubeController() (*KubeController, error) {
 		return nil, err
 	}
 
+	return NewKubeControllerFromClient(clientset.AppsV1().Deployments(apiv1.NamespaceDefault), options...)
+}
+
+func NewKubeControllerFromClient(client cliv1.DeploymentInterface, options ...KubeControllerOption) (*KubeController, error) {
 	controller := &KubeController{
-		client:      clientset.AppsV1().Deployments(apiv1.NamespaceDefault),
+		client:      client,
 		maxReplicas: maxReplicas,
 		minReplicas: minReplicas,
 	}
+	for _, option := range options {
+		option(controller)
+	}
 
 	if err := controller.updateState(); err != nil {
 		return nil, err
@@ -84,33 +149,132 @@ func (k *KubeController) updateState() error {
 	return nil
 }
 
-func (k *KubeController) replicas(service string, incomingRate float64, serviceRate float64) int32 {
+// replicas sizes a service whose replicas serve replicaRate(r) requests per
+// second each when every one of them receives r requests per second. Starting
+// from the capacity at the lightest load, replicas are added until they are
+// enough for the load each of them then receives.
+func (k *KubeController) replicas(service string, incomingRate float64, replicaRate func(float64) float64) int32 {
 	if incomingRate == 0.0 {
 		return k.minReplicas
 	}
 
-	replicas := int32(math.Ceil(incomingRate / (0.9 * serviceRate)))
-	if replicas > k.maxReplicas {
+	size := func(perReplica float64) float64 {
+		return math.Ceil(incomingRate / (0.9 * replicaRate(perReplica)))
+	}
+
+	replicas := size(0.0)
+	for ; replicas < float64(k.maxReplicas); replicas++ {
+		if size(incomingRate/replicas) <= replicas {
+			break
+		}
+	}
+	if replicas > float64(k.maxReplicas) {
 		return k.maxReplicas
 	}
 
-	return replicas
+	return int32(replicas)
+}
+
+// confident reports whether the estimates of a service are precise enough to
+// resize it.
+func (k *KubeController) confident(service string, estimates ...queue.Confidence) bool {
+	for _, estimate := range estimates {
+		if estimate.Samples < k.minSamples ||
+			(k.maxRelativeWidth > 0 && estimate.RelativeWidth() > k.maxRelativeWidth) {
+			log.Printf("not resizing service '%s': estimate %.4f in [%.4f, %.4f] from %d requests\n",
+				service, estimate.Estimate, estimate.Lower, estimate.Upper, estimate.Samples)
+			return false
+		}
+	}
+
+	return true
+}
+
+// applyBudget shares the replica budget among the services in expected when
+// they need more than it holds, counting the replicas of the other services
+// against it. It returns the services given fewer replicas than they need,
+// which are scaled down without waiting.
+func (k *KubeController) applyBudget(state *queue.QueueNetwork, expected map[string]int32) map[string]bool {
+	if k.replicaBudget <= 0 {
+		return nil
+	}
+
+	budget, total := k.replicaBudget, int32(0)
+	for service, deploy := range k.state {
+		if replicas, ok := expected[service]; ok {
+			total += replicas
+		} else {
+			budget -= deploy.replicas
+		}
+	}
+	if total <= budget {
+		return nil
+	}
+
+	log.Printf("services need %d replicas, %d available\n", total, budget)
+	constrained := map[string]bool{}
+	for service, replicas := range state.Allocate(budget, expected, k.weights) {
+		if replicas < expected[service] {
+			constrained[service] = true
+		}
+		expected[service] = replicas
+	}
+
+	return constrained
 }
 
 func (k *KubeController) Stabilize(state *queue.QueueNetwork) error {
 	incomingRates := state.IncomingRates()
 
+	current := make(map[string]int32, len(k.state))
+	for service, deploy := range k.state {
+		current[service] = deploy.replicas
+	}
+	analysis := state.Analyze(current)
+	intervals := state.IncomingRateIntervals()
+	budgets, unattainable := state.LatencyBudgets(k.slos, func(node string) float64 {
+		return state.ServiceRateAt(node, incomingRates[node]/float64(max(current[node], 1)))
+	})
+	for _, entry := range unattainable {
+		log.Printf("SLO of entry point '%s' is below the time its requests take to be served\n", entry)
+	}
+
+	expected := make(map[string]int32, len(k.state))
 	for service, deploy := range k.state {
 		rate, ok := incomingRates[service]
 		if !ok {
 			continue
 		}
 
-		expectedReplicas := k.replicas(service, rate, state.NodeMetrics[service].ServiceRate())
+		expectedReplicas := deploy.replicas
+		if k.confident(service, intervals[service], state.ServiceTimeConfidence(service)) {
+			expectedReplicas = k.replicas(service, rate, func(perReplica float64) float64 {
+				return state.ReplicaRateAt(service, perReplica)
+			})
+			for k.maxWaitingTime > 0 && expectedReplicas < k.maxReplicas &&
+				state.AnalyzeNode(service, rate, expectedReplicas).WaitingTime > k.maxWaitingTime.Seconds() {
+				expectedReplicas++
+			}
+			if budget, ok := budgets[service]; ok {
+				for expectedReplicas < k.maxReplicas && state.AnalyzeNode(service, rate, expectedReplicas).WaitingTime > budget {
+					expectedReplicas++
+				}
+			}
+		}
+		if node := analysis.Nodes[service]; node.Backlogged(queueLengthTolerance) &&
+			expectedReplicas <= deploy.replicas && deploy.replicas < k.maxReplicas {
+			expectedReplicas = deploy.replicas + 1
+		}
+		expected[service] = expectedReplicas
+	}
+
+	constrained := k.applyBudget(state, expected)
+	for service, expectedReplicas := range expected {
+		deploy := k.state[service]
 		if deploy.replicas == expectedReplicas {
 			deploy.scaledDowns = 0
 			deploy.scaleUps = 0
-		} else if deploy.replicas > expectedReplicas && deploy.scaledDowns < scaleDownsThreshold {
+		} else if deploy.replicas > expectedReplicas && deploy.scaledDowns < scaleDownsThreshold && !constrained[service] {
 			deploy.scaledDowns += 1
 		} else if deploy.replicas < expectedReplicas && deploy.scaleUps < scaleUpsThreshold {
 			deploy.scaleUps += 1
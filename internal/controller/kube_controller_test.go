@@ -0,0 +1,197 @@
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"gotest.tools/v3/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// stabilize runs a controller once over the network in snapshot, with a
+// deployment of one replica for every service, and returns their replicas.
+func stabilize(t *testing.T, services []string, snapshot string, observe func(*queue.QueueNetwork),
+	options ...controller.KubeControllerOption) map[string]int32 {
+	t.Helper()
+
+	var objects []runtime.Object
+	for _, name := range services {
+		replicas := int32(1)
+		objects = append(objects, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		})
+	}
+	client := fake.NewSimpleClientset(objects...).AppsV1().Deployments("default")
+
+	network := queue.NewQueueNetwork()
+	assert.NilError(t, json.Unmarshal([]byte(snapshot), network))
+	if observe != nil {
+		observe(network)
+	}
+
+	cont, err := controller.NewKubeControllerFromClient(client, options...)
+	assert.NilError(t, err)
+	assert.NilError(t, cont.Stabilize(network))
+
+	replicas := make(map[string]int32, len(services))
+	for _, name := range services {
+		deploy, err := client.Get(context.Background(), name, metav1.GetOptions{})
+		assert.NilError(t, err)
+		replicas[name] = *deploy.Spec.Replicas
+	}
+
+	return replicas
+}
+
+func TestKubeControllerStabilize(t *testing.T) {
+	t.Parallel()
+
+	observe := func(length float64) func(*queue.QueueNetwork) {
+		return func(network *queue.QueueNetwork) {
+			network.ObserveQueueLength("frontend", length, time.Now())
+		}
+	}
+
+	// 10 req/s against 100 req/s per replica
+	idle := `{"frontend": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 10, "totalRequests": 100}}`
+	// 500 req/s against 100 req/s per replica
+	busy := `{"frontend": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 500, "totalRequests": 100%s}}`
+	// 80 req/s against 100 req/s per replica
+	loaded := `{"frontend": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 80, "totalRequests": 100%s}}`
+	// one replica of each keeps up, frontend takes 10ms including the 5ms of
+	// backend
+	chain := `{
+		"backend": {"durationSum": 500000000, "requestCount": 100, "callers": {"frontend": 100}},
+		"frontend": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 80, "totalRequests": 100}
+	}`
+	confident := fmt.Sprintf(busy, `, "incomingRateWeightSquares": 0.6667, "incomingRateWeightSum": 1`)
+	slos := func(target time.Duration) controller.KubeControllerOption {
+		return controller.WithSLOs(map[string]queue.SLO{"frontend": {Target: target}})
+	}
+
+	for _, test := range []struct {
+		name     string
+		services []string
+		snapshot string
+		observe  func(*queue.QueueNetwork)
+		options  []controller.KubeControllerOption
+		expected map[string]int32
+	}{
+		{name: "queue not observed", snapshot: idle, expected: map[string]int32{"frontend": 1}},
+		{name: "queue as predicted", snapshot: idle, observe: observe(1), expected: map[string]int32{"frontend": 1}},
+		{name: "queue backlogged", snapshot: idle, observe: observe(5), expected: map[string]int32{"frontend": 2}},
+		{name: "sequential", snapshot: fmt.Sprintf(busy, ""), expected: map[string]int32{"frontend": 6}},
+		{
+			// 10ms alone, 20ms when 8 requests share the replica
+			name: "concurrent",
+			snapshot: fmt.Sprintf(busy, `, "concurrency": {
+				"1": {"durationSum": 100000000, "requestCount": 10},
+				"8": {"durationSum": 200000000, "requestCount": 10}
+			}`),
+			expected: map[string]int32{"frontend": 2},
+		},
+		{
+			// 10ms at 10 req/s per replica, 20ms at 100 req/s per replica: 6
+			// replicas sized at the lightest load would slow down to 18ms
+			name: "load dependent service time",
+			snapshot: fmt.Sprintf(busy, `, "load": {
+				"4": {"durationSum": 100000000, "intervals": 1, "rateSum": 10, "requestCount": 10},
+				"7": {"durationSum": 200000000, "intervals": 1, "rateSum": 100, "requestCount": 10}
+			}`),
+			expected: map[string]int32{"frontend": 9},
+		},
+		{
+			// exponential service times wait 40ms at 80% utilization
+			name:     "exponential waiting time",
+			snapshot: fmt.Sprintf(loaded, `, "histogram": {"buckets": {}, "count": 100, "sum": 1, "sumSquares": 0.02}`),
+			options:  []controller.KubeControllerOption{controller.WithMaxWaitingTime(50 * time.Millisecond)},
+			expected: map[string]int32{"frontend": 1},
+		},
+		{
+			// an SCV of 3 doubles the wait
+			name:     "variable waiting time",
+			snapshot: fmt.Sprintf(loaded, `, "histogram": {"buckets": {}, "count": 100, "sum": 1, "sumSquares": 0.04}`),
+			options:  []controller.KubeControllerOption{controller.WithMaxWaitingTime(50 * time.Millisecond)},
+			expected: map[string]int32{"frontend": 2},
+		},
+		{
+			name:     "enough samples",
+			snapshot: confident,
+			options:  []controller.KubeControllerOption{controller.WithMinSamples(100)},
+			expected: map[string]int32{"frontend": 6},
+		},
+		{
+			name:     "too few samples",
+			snapshot: confident,
+			options:  []controller.KubeControllerOption{controller.WithMinSamples(1000)},
+			expected: map[string]int32{"frontend": 1},
+		},
+		{
+			// the service time is known within ±20%, the rate within ±7%
+			name:     "narrow interval",
+			snapshot: confident,
+			options:  []controller.KubeControllerOption{controller.WithMaxRelativeWidth(0.5)},
+			expected: map[string]int32{"frontend": 6},
+		},
+		{
+			name:     "wide interval",
+			snapshot: confident,
+			options:  []controller.KubeControllerOption{controller.WithMaxRelativeWidth(0.3)},
+			expected: map[string]int32{"frontend": 1},
+		},
+		{
+			// every service needs 6 replicas on its own
+			name:     "replica budget",
+			services: []string{"admin", "backend", "frontend", "unmanaged"},
+			snapshot: `{
+				"admin": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 500, "totalRequests": 100},
+				"backend": {"durationSum": 1000000000, "requestCount": 100, "callers": {"frontend": 100}},
+				"frontend": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 500, "totalRequests": 100}
+			}`,
+			options:  []controller.KubeControllerOption{controller.WithReplicaBudget(15, map[string]float64{"admin": 0.1})},
+			expected: map[string]int32{"admin": 2, "backend": 6, "frontend": 6, "unmanaged": 1},
+		},
+		{
+			// 4ms of waiting at frontend, 2ms at backend
+			name:     "SLO",
+			services: []string{"backend", "frontend"},
+			snapshot: chain,
+			options:  []controller.KubeControllerOption{slos(16 * time.Millisecond)},
+			expected: map[string]int32{"backend": 2, "frontend": 2},
+		},
+		{
+			// no time left to wait
+			name:     "SLO without slack",
+			services: []string{"backend", "frontend"},
+			snapshot: chain,
+			options:  []controller.KubeControllerOption{slos(10 * time.Millisecond)},
+			expected: map[string]int32{"backend": 1, "frontend": 1},
+		},
+		{
+			// replicas cannot make requests be served faster
+			name:     "unattainable SLO",
+			services: []string{"backend", "frontend"},
+			snapshot: chain,
+			options:  []controller.KubeControllerOption{slos(8 * time.Millisecond)},
+			expected: map[string]int32{"backend": 1, "frontend": 1},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			services := test.services
+			if services == nil {
+				services = []string{"frontend"}
+			}
+
+			assert.DeepEqual(t, stabilize(t, services, test.snapshot, test.observe, test.options...), test.expected)
+		})
+	}
+}
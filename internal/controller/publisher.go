@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+)
+
+const DefaultPublishTimeout = 10 * time.Second
+
+// Publisher sends every state as a JSON snapshot to a remote queue-scaler,
+// which combines it with the snapshots of other publishers for its own
+// controllers. Publishers are told apart by name, the host name by default.
+type Publisher struct {
+	client *http.Client
+	name   string
+	token  string
+	url    string
+}
+
+type PublisherOption func(*Publisher)
+
+func NewPublisher(url string, options ...PublisherOption) *Publisher {
+	name, _ := os.Hostname()
+	publisher := &Publisher{
+		client: &http.Client{Timeout: DefaultPublishTimeout},
+		name:   name,
+		url:    url,
+	}
+
+	for _, opt := range options {
+		opt(publisher)
+	}
+
+	return publisher
+}
+
+func WithHTTPClient(client *http.Client) PublisherOption {
+	return func(publisher *Publisher) {
+		publisher.client = client
+	}
+}
+
+func WithPublisherName(name string) PublisherOption {
+	return func(publisher *Publisher) {
+		publisher.name = name
+	}
+}
+
+// WithToken authenticates the publisher with a bearer token.
+func WithToken(token string) PublisherOption {
+	return func(publisher *Publisher) {
+		publisher.token = token
+	}
+}
+
+func (p *Publisher) Stabilize(state *queue.QueueNetwork) error {
+	snapshot, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(snapshot))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.name != "" {
+		req.Header.Set(receiver.PublisherHeader, p.name)
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("publishing to %s: %s", p.url, resp.Status)
+	}
+
+	return nil
+}
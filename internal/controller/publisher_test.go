@@ -0,0 +1,48 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestPublisher(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan *queue.QueueNetwork, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := queue.NewQueueNetwork()
+		if err := json.NewDecoder(r.Body).Decode(state); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- state
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	state := queue.NewQueueNetwork()
+	state.AddExternalRequest(&receiver.Span{Duration: 100, ServiceName: "frontend", SpanId: "1"})
+
+	publisher := controller.NewPublisher(server.URL)
+	assert.NilError(t, publisher.Stabilize(state))
+	assert.Equal(t, (<-received).ToDOT(), state.ToDOT())
+}
+
+func TestPublisherRejected(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	publisher := controller.NewPublisher(server.URL, controller.WithHTTPClient(server.Client()))
+	assert.ErrorContains(t, publisher.Stabilize(queue.NewQueueNetwork()), "502 Bad Gateway")
+}
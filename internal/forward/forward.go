@@ -0,0 +1,264 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultQueueSize      = 1024
+	DefaultInitialBackoff = 5 * time.Second
+	DefaultMaxBackoff     = 30 * time.Second
+	DefaultMaxElapsed     = 5 * time.Minute
+	DefaultTimeout        = 10 * time.Second
+)
+
+var ErrClosed = errors.New("forwarder closed")
+
+// Forwarder sends export requests to a downstream OTLP endpoint from a
+// bounded queue, retrying failed exports with exponential backoff. Requests
+// arriving while the queue is full are dropped.
+type Forwarder struct {
+	cancel         context.CancelFunc
+	client         coltracepb.TraceServiceClient
+	closed         bool
+	conn           *grpc.ClientConn
+	ctx            context.Context
+	dialOptions    []grpc.DialOption
+	done           chan struct{}
+	dropped        atomic.Uint64
+	endpoint       string
+	failed         atomic.Uint64
+	forwarded      atomic.Uint64
+	headers        metadata.MD
+	initialBackoff time.Duration
+	lock           sync.RWMutex
+	maxBackoff     time.Duration
+	maxElapsed     time.Duration
+	queue          chan *coltracepb.ExportTraceServiceRequest
+	queueSize      int
+	timeout        time.Duration
+}
+
+type Option func(*Forwarder)
+
+func NewForwarder(endpoint string, options ...Option) (*Forwarder, error) {
+	forwarder := &Forwarder{
+		dialOptions: []grpc.DialOption{
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+		done:           make(chan struct{}),
+		endpoint:       endpoint,
+		headers:        metadata.MD{},
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		maxElapsed:     DefaultMaxElapsed,
+		queueSize:      DefaultQueueSize,
+		timeout:        DefaultTimeout,
+	}
+
+	for _, option := range options {
+		option(forwarder)
+	}
+
+	conn, err := grpc.NewClient(endpoint, forwarder.dialOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	forwarder.conn = conn
+	forwarder.client = coltracepb.NewTraceServiceClient(conn)
+	forwarder.queue = make(chan *coltracepb.ExportTraceServiceRequest, forwarder.queueSize)
+	forwarder.ctx, forwarder.cancel = context.WithCancel(context.Background())
+	go forwarder.run()
+
+	return forwarder, nil
+}
+
+func WithQueueSize(size int) Option {
+	return func(forwarder *Forwarder) {
+		forwarder.queueSize = size
+	}
+}
+
+// WithBackoff sets the delay before the first retry, the largest delay
+// between retries and how long a request is retried before being dropped.
+func WithBackoff(initial time.Duration, max time.Duration, elapsed time.Duration) Option {
+	return func(forwarder *Forwarder) {
+		forwarder.initialBackoff = initial
+		forwarder.maxBackoff = max
+		forwarder.maxElapsed = elapsed
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(forwarder *Forwarder) {
+		forwarder.timeout = timeout
+	}
+}
+
+// WithHeaders attaches metadata, such as credentials for the downstream
+// endpoint, to every forwarded request.
+func WithHeaders(headers map[string]string) Option {
+	return func(forwarder *Forwarder) {
+		for key, value := range headers {
+			forwarder.headers.Set(key, value)
+		}
+	}
+}
+
+func WithDialOptions(options ...grpc.DialOption) Option {
+	return func(forwarder *Forwarder) {
+		forwarder.dialOptions = append(forwarder.dialOptions, options...)
+	}
+}
+
+func countSpans(request *coltracepb.ExportTraceServiceRequest) uint64 {
+	count := uint64(0)
+	for _, resourceSpan := range request.ResourceSpans {
+		for _, scopeSpan := range resourceSpan.ScopeSpans {
+			count += uint64(len(scopeSpan.Spans))
+		}
+	}
+
+	return count
+}
+
+func (f *Forwarder) Endpoint() string {
+	return f.endpoint
+}
+
+// Forward queues a request for the downstream endpoint without blocking. The
+// request must not be modified afterwards.
+func (f *Forwarder) Forward(request *coltracepb.ExportTraceServiceRequest) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if f.closed {
+		return ErrClosed
+	}
+
+	select {
+	case f.queue <- request:
+	default:
+		f.dropped.Add(countSpans(request))
+	}
+
+	return nil
+}
+
+// ForwardedSpans returns the number of spans accepted downstream.
+func (f *Forwarder) ForwardedSpans() uint64 {
+	return f.forwarded.Load()
+}
+
+// DroppedSpans returns the number of spans dropped because the queue was
+// full.
+func (f *Forwarder) DroppedSpans() uint64 {
+	return f.dropped.Load()
+}
+
+// FailedSpans returns the number of spans given up on after failed exports.
+func (f *Forwarder) FailedSpans() uint64 {
+	return f.failed.Load()
+}
+
+func (f *Forwarder) run() {
+	defer close(f.done)
+
+	for request := range f.queue {
+		spans := countSpans(request)
+		if f.export(request) {
+			f.forwarded.Add(spans)
+		} else {
+			f.failed.Add(spans)
+		}
+	}
+}
+
+// retryable reports whether an export failed with one of the errors the OTLP
+// specification marks as transient, and the delay the server asked for.
+func retryable(err error) (bool, time.Duration) {
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+		codes.Unavailable, codes.DataLoss, codes.ResourceExhausted:
+	default:
+		return false, 0
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok && info.RetryDelay != nil {
+			return true, info.RetryDelay.AsDuration()
+		}
+	}
+
+	return st.Code() != codes.ResourceExhausted, 0
+}
+
+func (f *Forwarder) export(request *coltracepb.ExportTraceServiceRequest) bool {
+	deadline := time.Now().Add(f.maxElapsed)
+	backoff := f.initialBackoff
+
+	for {
+		ctx, cancel := context.WithTimeout(f.ctx, f.timeout)
+		ctx = metadata.NewOutgoingContext(ctx, f.headers)
+		_, err := f.client.Export(ctx, request)
+		cancel()
+		if err == nil {
+			return true
+		}
+
+		retry, delay := retryable(err)
+		if !retry || f.ctx.Err() != nil {
+			return false
+		}
+		if delay == 0 {
+			delay = backoff
+			backoff = min(2*backoff, f.maxBackoff)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return false
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-f.ctx.Done():
+			return false
+		}
+	}
+}
+
+// Shutdown stops accepting requests and waits for the queued ones to be
+// forwarded. Once ctx is done, pending retries are abandoned.
+func (f *Forwarder) Shutdown(ctx context.Context) error {
+	f.lock.Lock()
+	if !f.closed {
+		f.closed = true
+		close(f.queue)
+	}
+	f.lock.Unlock()
+
+	var err error
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		f.cancel()
+		<-f.done
+		err = ctx.Err()
+	}
+	f.cancel()
+
+	return errors.Join(err, f.conn.Close())
+}
@@ -0,0 +1,162 @@
+package forward_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/forward"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gotest.tools/v3/assert"
+)
+
+type downstream struct {
+	coltracepb.UnimplementedTraceServiceServer
+	block    chan struct{}
+	code     codes.Code
+	failures int
+	headers  []metadata.MD
+	lock     sync.Mutex
+	requests []*coltracepb.ExportTraceServiceRequest
+	received chan struct{}
+}
+
+func (d *downstream) Export(
+	ctx context.Context, in *coltracepb.ExportTraceServiceRequest,
+) (*coltracepb.ExportTraceServiceResponse, error) {
+	if d.received != nil {
+		d.received <- struct{}{}
+		<-d.block
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.failures > 0 {
+		d.failures--
+		return nil, status.Error(d.code, "downstream failure")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	d.headers = append(d.headers, md)
+	d.requests = append(d.requests, in)
+
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func startDownstream(t *testing.T, d *downstream) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	server := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(server, d)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return lis.Addr().String()
+}
+
+func request(spans int) *coltracepb.ExportTraceServiceRequest {
+	scope := &tracepb.ScopeSpans{}
+	for i := 0; i < spans; i++ {
+		scope.Spans = append(scope.Spans, &tracepb.Span{SpanId: []byte{byte(i)}})
+	}
+
+	return &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{
+		{ScopeSpans: []*tracepb.ScopeSpans{scope}},
+	}}
+}
+
+func TestForward(t *testing.T) {
+	t.Parallel()
+
+	d := &downstream{}
+	forwarder, err := forward.NewForwarder(startDownstream(t, d),
+		forward.WithHeaders(map[string]string{"authorization": "Bearer downstream"}))
+	assert.NilError(t, err)
+
+	assert.NilError(t, forwarder.Forward(request(2)))
+	assert.NilError(t, forwarder.Forward(request(3)))
+	assert.NilError(t, forwarder.Shutdown(context.Background()))
+
+	assert.Equal(t, forwarder.ForwardedSpans(), uint64(5))
+	assert.Equal(t, len(d.requests), 2)
+	assert.DeepEqual(t, d.headers[0].Get("authorization"), []string{"Bearer downstream"})
+	assert.ErrorIs(t, forwarder.Forward(request(1)), forward.ErrClosed)
+}
+
+func TestForwardRetry(t *testing.T) {
+	t.Parallel()
+
+	d := &downstream{code: codes.Unavailable, failures: 2}
+	forwarder, err := forward.NewForwarder(startDownstream(t, d),
+		forward.WithBackoff(time.Millisecond, 4*time.Millisecond, time.Second))
+	assert.NilError(t, err)
+
+	assert.NilError(t, forwarder.Forward(request(1)))
+	assert.NilError(t, forwarder.Shutdown(context.Background()))
+
+	assert.Equal(t, forwarder.ForwardedSpans(), uint64(1))
+	assert.Equal(t, forwarder.FailedSpans(), uint64(0))
+	assert.Equal(t, d.failures, 0)
+}
+
+func TestForwardPermanentError(t *testing.T) {
+	t.Parallel()
+
+	d := &downstream{code: codes.InvalidArgument, failures: 1}
+	forwarder, err := forward.NewForwarder(startDownstream(t, d),
+		forward.WithBackoff(time.Millisecond, time.Millisecond, time.Second))
+	assert.NilError(t, err)
+
+	assert.NilError(t, forwarder.Forward(request(2)))
+	assert.NilError(t, forwarder.Forward(request(1)))
+	assert.NilError(t, forwarder.Shutdown(context.Background()))
+
+	assert.Equal(t, forwarder.FailedSpans(), uint64(2))
+	assert.Equal(t, forwarder.ForwardedSpans(), uint64(1))
+}
+
+func TestForwardQueueFull(t *testing.T) {
+	t.Parallel()
+
+	d := &downstream{block: make(chan struct{}), received: make(chan struct{}, 3)}
+	forwarder, err := forward.NewForwarder(startDownstream(t, d), forward.WithQueueSize(1))
+	assert.NilError(t, err)
+
+	// the first request is in flight, the second fills the queue
+	assert.NilError(t, forwarder.Forward(request(1)))
+	<-d.received
+	assert.NilError(t, forwarder.Forward(request(2)))
+	assert.NilError(t, forwarder.Forward(request(3)))
+	close(d.block)
+
+	assert.NilError(t, forwarder.Shutdown(context.Background()))
+	assert.Equal(t, forwarder.ForwardedSpans(), uint64(3))
+	assert.Equal(t, forwarder.DroppedSpans(), uint64(3))
+}
+
+func TestForwardShutdownTimeout(t *testing.T) {
+	t.Parallel()
+
+	d := &downstream{code: codes.Unavailable, failures: 1000}
+	forwarder, err := forward.NewForwarder(startDownstream(t, d),
+		forward.WithBackoff(time.Hour, time.Hour, 2*time.Hour))
+	assert.NilError(t, err)
+
+	assert.NilError(t, forwarder.Forward(request(1)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, forwarder.Shutdown(ctx), context.DeadlineExceeded)
+	assert.Equal(t, forwarder.FailedSpans(), uint64(1))
+}
@@ -0,0 +1,253 @@
+package harness
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/clock"
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/observer"
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"github.com/pako-23/queue-scaler/internal/simulator"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	cliv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+)
+
+const (
+	DefaultDuration     = 10 * time.Minute
+	DefaultSLO          = 500 * time.Millisecond
+	DefaultStartupDelay = 10 * time.Second
+	resolution          = time.Second
+)
+
+type Report struct {
+	Requests        uint64
+	ReplicaSeconds  float64
+	SLOViolations   uint64
+	ScalingActions  int
+	StabilizeErrors int
+}
+
+type change struct {
+	at       time.Duration
+	replicas int32
+}
+
+type Harness struct {
+	cluster      cliv1.DeploymentInterface
+	duration     time.Duration
+	interval     time.Duration
+	network      *queue.QueueNetwork
+	nodes        []string
+	profile      Profile
+	replicas     map[string]int32
+	seed         int64
+	slo          time.Duration
+	startupDelay time.Duration
+}
+
+type Option func(*Harness)
+
+func NewHarness(network *queue.QueueNetwork, options ...Option) *Harness {
+	harness := &Harness{
+		duration:     DefaultDuration,
+		interval:     observer.DefaultInterval,
+		network:      network,
+		nodes:        make([]string, 0, len(network.NodeMetrics)),
+		profile:      &Constant{Value: 1.0},
+		replicas:     map[string]int32{},
+		seed:         simulator.DefaultSeed,
+		slo:          DefaultSLO,
+		startupDelay: DefaultStartupDelay,
+	}
+
+	for _, opt := range options {
+		opt(harness)
+	}
+
+	deployments := make([]runtime.Object, 0, len(network.NodeMetrics))
+	for node := range network.NodeMetrics {
+		replicas, ok := harness.replicas[node]
+		if !ok || replicas < 1 {
+			replicas = 1
+		}
+		harness.replicas[node] = replicas
+		harness.nodes = append(harness.nodes, node)
+
+		deployments = append(deployments, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: node, Namespace: apiv1.NamespaceDefault},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		})
+	}
+	sort.Strings(harness.nodes)
+
+	harness.cluster = fake.NewSimpleClientset(deployments...).
+		AppsV1().Deployments(apiv1.NamespaceDefault)
+
+	return harness
+}
+
+func WithDuration(duration time.Duration) Option {
+	return func(harness *Harness) {
+		harness.duration = duration
+	}
+}
+
+func WithInterval(interval time.Duration) Option {
+	return func(harness *Harness) {
+		harness.interval = interval
+	}
+}
+
+func WithProfile(profile Profile) Option {
+	return func(harness *Harness) {
+		harness.profile = profile
+	}
+}
+
+func WithReplicas(replicas map[string]int32) Option {
+	return func(harness *Harness) {
+		for node, count := range replicas {
+			harness.replicas[node] = count
+		}
+	}
+}
+
+func WithSeed(seed int64) Option {
+	return func(harness *Harness) {
+		harness.seed = seed
+	}
+}
+
+func WithSLO(slo time.Duration) Option {
+	return func(harness *Harness) {
+		harness.slo = slo
+	}
+}
+
+func WithStartupDelay(delay time.Duration) Option {
+	return func(harness *Harness) {
+		harness.startupDelay = delay
+	}
+}
+
+func (h *Harness) Cluster() cliv1.DeploymentInterface {
+	return h.cluster
+}
+
+func spanId(id uint64) string {
+	if id == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%016x", id)
+}
+
+func toSpan(visit *simulator.Visit) *receiver.Span {
+	return &receiver.Span{
+		Duration:    uint64(visit.Departure - visit.Arrival),
+		Parent:      spanId(visit.Parent),
+		ServiceName: visit.Node,
+		SpanId:      spanId(visit.Span),
+		StartTime:   uint64(visit.Arrival),
+		TraceId:     fmt.Sprintf("%032x", visit.Trace),
+	}
+}
+
+func (h *Harness) Run(cont controller.Controller) (*Report, error) {
+	report := &Report{}
+	epoch := time.Unix(0, 0)
+	clk := clock.NewFake(epoch)
+	obs := observer.NewObserver(
+		observer.WithClock(clk),
+		observer.WithInterval(h.interval),
+		observer.WithController(cont))
+	obs.Start()
+
+	sim := simulator.NewSimulator(h.network,
+		simulator.WithSeed(h.seed),
+		simulator.WithReplicas(h.replicas),
+		simulator.WithVisitHandler(func(visit *simulator.Visit) {
+			obs.Record(toSpan(visit))
+		}),
+		simulator.WithRequestHandler(func(request *simulator.Request) {
+			report.Requests += 1
+			if request.End-request.Start > h.slo {
+				report.SLOViolations += 1
+			}
+		}))
+
+	base := sim.ArrivalRates()
+	desired := make(map[string]int32, len(h.replicas))
+	for node, replicas := range h.replicas {
+		desired[node] = replicas
+	}
+	pending := map[string]*change{}
+	multiplier := 1.0
+	nextTick := h.interval
+
+	for sim.Now() < h.duration {
+		now := sim.Now()
+
+		if value := h.profile.Multiplier(now); value != multiplier {
+			multiplier = value
+			for _, node := range h.nodes {
+				if rate, ok := base[node]; ok {
+					sim.SetArrivalRate(node, rate*multiplier)
+				}
+			}
+		}
+
+		for _, node := range h.nodes {
+			if next, ok := pending[node]; ok && next.at <= now {
+				sim.SetReplicas(node, next.replicas)
+				delete(pending, node)
+			}
+		}
+
+		sim.RunUntil(min(now+resolution, h.duration))
+		if sim.Now() < nextTick {
+			continue
+		}
+		nextTick += h.interval
+
+		clk.Set(epoch.Add(sim.Now()))
+		if err := obs.Tick(); err != nil {
+			report.StabilizeErrors += 1
+		}
+
+		deployments, err := h.cluster.List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, deploy := range deployments.Items {
+			replicas := *deploy.Spec.Replicas
+			if replicas == desired[deploy.Name] {
+				continue
+			}
+
+			report.ScalingActions += 1
+			desired[deploy.Name] = replicas
+			if replicas > sim.Replicas()[deploy.Name] {
+				pending[deploy.Name] = &change{at: sim.Now() + h.startupDelay, replicas: replicas}
+			} else {
+				sim.SetReplicas(deploy.Name, replicas)
+				delete(pending, deploy.Name)
+			}
+		}
+	}
+
+	for _, result := range sim.Results() {
+		report.ReplicaSeconds += result.ReplicaSeconds
+	}
+
+	return report, nil
+}
@@ -0,0 +1,114 @@
+package harness_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/harness"
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var errController = errors.New("")
+
+type failingController struct{}
+
+func (f *failingController) Stabilize(*queue.QueueNetwork) error { return errController }
+
+func compareFloats(value float64, expected float64, eps float64) cmp.Comparison {
+	return func() cmp.Result {
+		if math.Abs(expected-value) > eps {
+			return cmp.ResultFailure(fmt.Sprintf("expected %f, but got %f", expected, value))
+		}
+
+		return cmp.ResultSuccess
+	}
+}
+
+func testNetwork(t *testing.T) *queue.QueueNetwork {
+	t.Helper()
+
+	network := queue.NewQueueNetwork()
+	assert.NilError(t, json.Unmarshal([]byte(`{
+		"node1": {"durationSum": 500000000, "requestCount": 100, "incomingRate": 100, "totalRequests": 100},
+		"node2": {"callers": {"node1": 100}, "durationSum": 1000000000, "requestCount": 100}
+	}`), network))
+
+	return network
+}
+
+func TestHarnessNullController(t *testing.T) {
+	t.Parallel()
+
+	h := harness.NewHarness(testNetwork(t),
+		harness.WithDuration(time.Minute),
+		harness.WithReplicas(map[string]int32{"node2": 2}))
+	report, err := h.Run(&controller.NullController{})
+	assert.NilError(t, err)
+
+	assert.Assert(t, report.Requests > 5000)
+	assert.Assert(t, report.SLOViolations < report.Requests/100)
+	assert.Equal(t, 0, report.ScalingActions)
+	assert.Equal(t, 0, report.StabilizeErrors)
+	assert.Assert(t, compareFloats(report.ReplicaSeconds, 180.0, 10e-6))
+}
+
+func TestHarnessStabilizeErrors(t *testing.T) {
+	t.Parallel()
+
+	h := harness.NewHarness(testNetwork(t),
+		harness.WithDuration(time.Minute),
+		harness.WithInterval(10*time.Second))
+	report, err := h.Run(&failingController{})
+	assert.NilError(t, err)
+	assert.Equal(t, 6, report.StabilizeErrors)
+}
+
+func TestHarnessDeterministic(t *testing.T) {
+	t.Parallel()
+
+	run := func() *harness.Report {
+		h := harness.NewHarness(testNetwork(t),
+			harness.WithDuration(time.Minute),
+			harness.WithProfile(&harness.Spike{Base: 1.0, Peak: 2.0, At: 20 * time.Second, Duration: 10 * time.Second}),
+			harness.WithSeed(3))
+		report, err := h.Run(&controller.NullController{})
+		assert.NilError(t, err)
+
+		return report
+	}
+
+	assert.DeepEqual(t, run(), run())
+}
+
+func TestHarnessKubeController(t *testing.T) {
+	t.Parallel()
+
+	h := harness.NewHarness(testNetwork(t),
+		harness.WithDuration(3*time.Minute),
+		harness.WithProfile(&harness.Step{Before: 1.0, After: 3.0, At: time.Minute}),
+		harness.WithSLO(200*time.Millisecond),
+		harness.WithStartupDelay(5*time.Second))
+
+	cont, err := controller.NewKubeControllerFromClient(h.Cluster())
+	assert.NilError(t, err)
+
+	report, err := h.Run(cont)
+	assert.NilError(t, err)
+	assert.Assert(t, report.ScalingActions > 0)
+	assert.Assert(t, report.ReplicaSeconds > 360.0)
+
+	deployments, err := h.Cluster().List(context.Background(), metav1.ListOptions{})
+	assert.NilError(t, err)
+	for _, deploy := range deployments.Items {
+		assert.Assert(t, *deploy.Spec.Replicas > 1, "deployment %s was not scaled up", deploy.Name)
+	}
+}
@@ -0,0 +1,82 @@
+package harness
+
+import (
+	"math"
+	"time"
+)
+
+type Profile interface {
+	Multiplier(at time.Duration) float64
+}
+
+type Constant struct {
+	Value float64
+}
+
+func (c *Constant) Multiplier(time.Duration) float64 {
+	return c.Value
+}
+
+type Step struct {
+	After  float64
+	At     time.Duration
+	Before float64
+}
+
+func (s *Step) Multiplier(at time.Duration) float64 {
+	if at < s.At {
+		return s.Before
+	}
+
+	return s.After
+}
+
+type Ramp struct {
+	End   time.Duration
+	From  float64
+	Start time.Duration
+	To    float64
+}
+
+func (r *Ramp) Multiplier(at time.Duration) float64 {
+	if at <= r.Start {
+		return r.From
+	} else if at >= r.End {
+		return r.To
+	}
+
+	progress := float64(at-r.Start) / float64(r.End-r.Start)
+
+	return r.From + progress*(r.To-r.From)
+}
+
+type Diurnal struct {
+	Amplitude float64
+	Base      float64
+	Period    time.Duration
+}
+
+func (d *Diurnal) Multiplier(at time.Duration) float64 {
+	if d.Period == 0 {
+		return d.Base
+	}
+
+	phase := 2 * math.Pi * float64(at) / float64(d.Period)
+
+	return math.Max(0, d.Base+d.Amplitude*math.Sin(phase))
+}
+
+type Spike struct {
+	At       time.Duration
+	Base     float64
+	Duration time.Duration
+	Peak     float64
+}
+
+func (s *Spike) Multiplier(at time.Duration) float64 {
+	if at >= s.At && at < s.At+s.Duration {
+		return s.Peak
+	}
+
+	return s.Base
+}
@@ -0,0 +1,37 @@
+package harness_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/harness"
+	"gotest.tools/v3/assert"
+)
+
+func TestProfiles(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		profile  harness.Profile
+		at       time.Duration
+		expected float64
+	}{
+		{profile: &harness.Constant{Value: 2.0}, at: time.Hour, expected: 2.0},
+		{profile: &harness.Step{Before: 1.0, After: 3.0, At: time.Minute}, at: 0, expected: 1.0},
+		{profile: &harness.Step{Before: 1.0, After: 3.0, At: time.Minute}, at: time.Minute, expected: 3.0},
+		{profile: &harness.Ramp{From: 1.0, To: 3.0, Start: time.Minute, End: 3 * time.Minute}, at: 0, expected: 1.0},
+		{profile: &harness.Ramp{From: 1.0, To: 3.0, Start: time.Minute, End: 3 * time.Minute}, at: 2 * time.Minute, expected: 2.0},
+		{profile: &harness.Ramp{From: 1.0, To: 3.0, Start: time.Minute, End: 3 * time.Minute}, at: time.Hour, expected: 3.0},
+		{profile: &harness.Diurnal{Base: 1.0, Amplitude: 0.5, Period: 4 * time.Hour}, at: 0, expected: 1.0},
+		{profile: &harness.Diurnal{Base: 1.0, Amplitude: 0.5, Period: 4 * time.Hour}, at: time.Hour, expected: 1.5},
+		{profile: &harness.Diurnal{Base: 1.0, Amplitude: 0.5, Period: 4 * time.Hour}, at: 3 * time.Hour, expected: 0.5},
+		{profile: &harness.Diurnal{Base: 0.5, Amplitude: 1.0, Period: 4 * time.Hour}, at: 3 * time.Hour, expected: 0.0},
+		{profile: &harness.Spike{Base: 1.0, Peak: 5.0, At: time.Minute, Duration: time.Minute}, at: 0, expected: 1.0},
+		{profile: &harness.Spike{Base: 1.0, Peak: 5.0, At: time.Minute, Duration: time.Minute}, at: 90 * time.Second, expected: 5.0},
+		{profile: &harness.Spike{Base: 1.0, Peak: 5.0, At: time.Minute, Duration: time.Minute}, at: 2 * time.Minute, expected: 1.0},
+	}
+
+	for _, test := range tests {
+		assert.Assert(t, compareFloats(test.profile.Multiplier(test.at), test.expected, 10e-9))
+	}
+}
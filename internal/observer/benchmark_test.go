@@ -0,0 +1,60 @@
+package observer_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/observer"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+)
+
+// BenchmarkObserve measures how many spans per second the observer loop
+// accepts when they are delivered one per batch and in larger batches.
+func BenchmarkObserve(b *testing.B) {
+	for _, size := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			batches := make([]receiver.Batch, 0, b.N/size+1)
+			for sent := 0; sent < b.N; {
+				batch := receiver.Batch{}
+				for i := 0; i < size && sent < b.N; i++ {
+					traceId := fmt.Sprintf("trace%d", sent/2)
+					span := &receiver.Span{
+						Duration:    100,
+						ServiceName: "service1",
+						SpanId:      fmt.Sprintf("span%d", sent%2),
+						StartTime:   uint64(sent),
+						TraceId:     traceId,
+					}
+					if sent%2 == 1 {
+						span.Parent = "span0"
+						span.ServiceName = "service2"
+					}
+					batch.Add(span)
+					sent += 1
+				}
+				batches = append(batches, batch)
+			}
+
+			obs := observer.NewObserver(observer.WithInterval(time.Millisecond))
+			ctx, cancel := context.WithCancel(context.Background())
+			ch := make(chan receiver.Batch)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				obs.Observe(ctx, ch)
+			}()
+
+			b.ResetTimer()
+			for _, batch := range batches {
+				ch <- batch
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "spans/s")
+
+			cancel()
+			<-done
+		})
+	}
+}
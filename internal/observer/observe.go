@@ -3,6 +3,7 @@ package observer
 import (
 	"context"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/pako-23/queue-scaler/internal/queue"
@@ -11,9 +12,24 @@ import (
 
 type trace map[string]*receiver.Span
 
+// parent returns the parent of a span. Children of a Zipkin span shared
+// between a client and a server belong to the server side.
+func (t trace) parent(span *receiver.Span) (*receiver.Span, bool) {
+	shared := span.Parent + receiver.SharedSpanSuffix
+	if shared != span.SpanId {
+		if parent, ok := t[shared]; ok {
+			return parent, true
+		}
+	}
+
+	parent, ok := t[span.Parent]
+
+	return parent, ok
+}
+
 func (t trace) completed() bool {
 	for _, details := range t {
-		if _, ok := t[details.Parent]; !ok && details.Parent != "" {
+		if _, ok := t.parent(details); !ok && details.Parent != "" {
 			return false
 		}
 	}
@@ -31,7 +47,8 @@ func processTraces(state *queue.QueueNetwork, traces map[string]trace) {
 			if details.Parent == "" {
 				state.AddExternalRequest(details)
 			} else {
-				state.AddInternalRequest(spans[details.Parent], details)
+				parent, _ := spans.parent(details)
+				state.AddInternalRequest(parent, details)
 			}
 		}
 
@@ -40,32 +57,252 @@ func processTraces(state *queue.QueueNetwork, traces map[string]trace) {
 
 }
 
-func (o *Observer) Observe(ctx context.Context, ch <-chan *receiver.Span) {
-	traces := map[string]trace{}
+func (o *Observer) newDelta() *queue.QueueNetwork {
+	delta := queue.NewQueueNetwork()
+	if o.eventTime {
+		delta.UseEventTime(o.windowStart, o.Interval)
+	}
+
+	return delta
+}
+
+func (o *Observer) initShards() {
+	if len(o.shards) > 0 {
+		return
+	}
+
+	o.shards = make([]*shard, o.shardCount)
+	for i := range o.shards {
+		o.shards[i] = newShard(o.newDelta)
+	}
+}
+
+func (o *Observer) record(at time.Time, span *receiver.Span) bool {
+	if o.recorder != nil {
+		if err := o.recorder.RecordSpan(at, span); err != nil {
+			log.Println(err)
+		}
+	}
+
+	return span.ServiceName != ""
+}
+
+func (o *Observer) Record(span *receiver.Span) {
+	if !o.record(o.clock.Now(), span) {
+		return
+	}
+
+	o.initShards()
+	target := o.shards[shardIndex(span.TraceId, len(o.shards))]
+	if o.running {
+		target.messages <- shardMessage{batch: receiver.Batch{span.TraceId: {span}}}
+	} else {
+		target.record(span)
+	}
+}
+
+// RecordBatch merges the spans of a batch into the trace buffers of the
+// shards owning their traces. All the spans of the batch are recorded as
+// received at the same instant.
+func (o *Observer) RecordBatch(batch receiver.Batch) {
+	now := o.clock.Now()
+	o.initShards()
+
+	parts := make([]receiver.Batch, len(o.shards))
+	for traceId, spans := range batch {
+		index := shardIndex(traceId, len(o.shards))
+		for _, span := range spans {
+			if !o.record(now, span) {
+				continue
+			}
+
+			if parts[index] == nil {
+				parts[index] = receiver.Batch{}
+			}
+			parts[index].Add(span)
+		}
+	}
+
+	for index, part := range parts {
+		if part == nil {
+			continue
+		}
+
+		if o.running {
+			o.shards[index].messages <- shardMessage{batch: part}
+			continue
+		}
+
+		for _, spans := range part {
+			for _, span := range spans {
+				o.shards[index].record(span)
+			}
+		}
+	}
+}
+
+// RecordMetrics adds requests known only through aggregated metrics to the
+// model.
+func (o *Observer) RecordMetrics(metrics *receiver.Metrics) {
+	if o.recorder != nil {
+		if err := o.recorder.RecordMetrics(o.clock.Now(), metrics); err != nil {
+			log.Println(err)
+		}
+	}
+
+	o.State.AddMetrics(metrics)
+}
 
-	ticker := time.NewTicker(o.Interval)
+func (o *Observer) RecordQueueLengths(lengths map[string]float64) {
+	now := o.clock.Now()
+	if o.recorder != nil {
+		if err := o.recorder.RecordQueueLengths(now, lengths, o.queueLengthAge); err != nil {
+			log.Println(err)
+		}
+	}
+
+	o.State.ObserveQueueLengths(lengths, now)
+}
+
+func (o *Observer) Start() {
+	o.lastTick = o.clock.Now()
+	o.windowStart = o.lastTick
+	if o.eventTime {
+		o.State.UseEventTime(o.lastTick, o.Interval)
+	}
+
+	// spans recorded before starting stay in their shards, only the deltas,
+	// empty between flushes, start over from the new window
+	o.initShards()
+	for _, shard := range o.shards {
+		shard.delta = o.newDelta()
+	}
+
+	if o.recorder != nil {
+		if err := o.recorder.RecordStart(o.lastTick); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func (o *Observer) collect() {
+	o.initShards()
+
+	if !o.running {
+		for _, shard := range o.shards {
+			o.State.Merge(shard.flush())
+		}
+		return
+	}
+
+	deltas := make(chan *queue.QueueNetwork, len(o.shards))
+	for _, shard := range o.shards {
+		shard.messages <- shardMessage{flush: deltas}
+	}
+	for range o.shards {
+		o.State.Merge(<-deltas)
+	}
+}
+
+// update folds the traces completed since the previous tick into the model
+// and refreshes the arrival rate estimates.
+func (o *Observer) update() {
+	now := o.clock.Now()
+	elapsed := o.Interval
+	if !o.lastTick.IsZero() {
+		elapsed = now.Sub(o.lastTick)
+	}
+	o.lastTick = now
+
+	if o.recorder != nil {
+		if err := o.recorder.RecordTick(now, elapsed); err != nil {
+			log.Println(err)
+		}
+	}
+
+	o.collect()
+	if o.queueLengthAge > 0 {
+		o.State.ExpireQueueLengths(now.Add(-o.queueLengthAge))
+	}
+	o.State.SettleConcurrency()
+	o.State.RecordLoad(elapsed)
+	if o.eventTime {
+		o.State.CloseWindows(now.Add(-o.lateness))
+	} else {
+		o.State.UpdateEstimates(elapsed)
+	}
+}
+
+func (o *Observer) Tick() error {
+	o.update()
+
+	return o.controller.Stabilize(o.State)
+}
+
+// stabilize runs the controller on the snapshots it receives. Only the most
+// recent snapshot is kept while the controller is busy.
+func (o *Observer) stabilize(snapshots <-chan *queue.QueueNetwork) {
+	for state := range snapshots {
+		if err := o.controller.Stabilize(state); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func (o *Observer) Observe(ctx context.Context, ch <-chan receiver.Batch) {
+	var workers, stabilizer sync.WaitGroup
+
+	ticker := o.clock.NewTicker(o.Interval)
 	defer ticker.Stop()
 
+	o.Start()
+	o.running = true
+	for _, shard := range o.shards {
+		shard.messages = make(chan shardMessage, shardBuffer)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			shard.run()
+		}()
+	}
+
+	snapshots := make(chan *queue.QueueNetwork, 1)
+	stabilizer.Add(1)
+	go func() {
+		defer stabilizer.Done()
+		o.stabilize(snapshots)
+	}()
+
+	defer func() {
+		for _, shard := range o.shards {
+			close(shard.messages)
+		}
+		workers.Wait()
+		o.running = false
+
+		close(snapshots)
+		stabilizer.Wait()
+	}()
+
 	for {
 		select {
-		case <-ticker.C:
-			processTraces(o.State, traces)
-			o.State.UpdateEstimates(o.Interval)
+		case <-ticker.C():
+			o.update()
 
-			if err := o.controller.Stabilize(o.State); err != nil {
-				log.Println(err)
+			select {
+			case <-snapshots:
+			default:
 			}
+			snapshots <- o.State.Clone()
 
-		case span := <-ch:
-			if span.ServiceName == "" {
-				continue
-			}
+		case batch := <-ch:
+			o.RecordBatch(batch)
 
-			if _, ok := traces[span.TraceId]; !ok {
-				traces[span.TraceId] = trace{}
-			}
+		case metrics := <-o.metrics:
+			o.RecordMetrics(metrics)
 
-			traces[span.TraceId][span.SpanId] = span
+		case lengths := <-o.queueLengths:
+			o.RecordQueueLengths(lengths)
 
 		case <-ctx.Done():
 			return
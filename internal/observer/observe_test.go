@@ -3,10 +3,12 @@ package observer_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/pako-23/queue-scaler/internal/clock"
 	"github.com/pako-23/queue-scaler/internal/observer"
 	"github.com/pako-23/queue-scaler/internal/queue"
 	"github.com/pako-23/queue-scaler/internal/receiver"
@@ -18,9 +20,14 @@ var errController = errors.New("")
 type testController struct {
 	queue *queue.QueueNetwork
 	fail  bool
+	ticks chan struct{}
 }
 
 func (t *testController) Stabilize(state *queue.QueueNetwork) error {
+	if t.ticks != nil {
+		defer func() { t.ticks <- struct{}{} }()
+	}
+
 	if t.fail {
 		return errController
 	}
@@ -37,7 +44,7 @@ func TestObserveNoTrace(t *testing.T) {
 		observer.WithInterval(time.Second),
 		observer.WithController(cont))
 	ctx, cancel := context.WithCancel(context.Background())
-	ch := make(chan *receiver.Span)
+	ch := make(chan receiver.Batch)
 	go func() { cancel() }()
 
 	obs.Observe(ctx, ch)
@@ -81,21 +88,24 @@ func TestFailStabilize(t *testing.T) {
 		},
 	}
 
-	cont := &testController{fail: true}
+	cont := &testController{fail: true, ticks: make(chan struct{})}
 	interval := 50 * time.Millisecond
+	clk := clock.NewFake(time.Unix(0, 0))
 	obs := observer.NewObserver(
+		observer.WithClock(clk),
 		observer.WithInterval(interval),
 		observer.WithController(cont))
 	ctx, cancel := context.WithCancel(context.Background())
-	ch := make(chan *receiver.Span)
+	ch := make(chan receiver.Batch)
 
 	go func() {
 
 		for _, span := range spans {
-			ch <- span
+			ch <- receiver.Batch{span.TraceId: {span}}
 		}
 
-		time.Sleep(interval + interval/2)
+		clk.Advance(interval)
+		<-cont.ticks
 		cancel()
 	}()
 
@@ -111,7 +121,7 @@ func TestObserveBeforeTimout(t *testing.T) {
 		observer.WithInterval(time.Second),
 		observer.WithController(cont))
 	ctx, cancel := context.WithCancel(context.Background())
-	ch := make(chan *receiver.Span)
+	ch := make(chan receiver.Batch)
 
 	go func() {
 		spans := []*receiver.Span{
@@ -134,7 +144,7 @@ func TestObserveBeforeTimout(t *testing.T) {
 		}
 
 		for _, span := range spans {
-			ch <- span
+			ch <- receiver.Batch{span.TraceId: {span}}
 		}
 
 		cancel()
@@ -144,25 +154,30 @@ func TestObserveBeforeTimout(t *testing.T) {
 	assert.Assert(t, cont.queue == nil)
 }
 
-func observeTest(expected string, spans [][]*receiver.Span) func(*testing.T) {
+func observeTest(expected string, spans [][]*receiver.Span, elapsed time.Duration) func(*testing.T) {
 	return func(t *testing.T) {
 		t.Parallel()
 
-		cont := &testController{fail: false}
+		cont := &testController{fail: false, ticks: make(chan struct{})}
 		interval := 50 * time.Millisecond
+		clk := clock.NewFake(time.Unix(0, 0))
 		obs := observer.NewObserver(
+			observer.WithClock(clk),
 			observer.WithInterval(interval),
 			observer.WithController(cont))
 		ctx, cancel := context.WithCancel(context.Background())
-		ch := make(chan *receiver.Span)
+		ch := make(chan receiver.Batch)
 
 		go func() {
-			for _, batch := range spans {
-				for _, span := range batch {
-					ch <- span
+			for _, delivery := range spans {
+				batch := receiver.Batch{}
+				for _, span := range delivery {
+					batch.Add(span)
 				}
+				ch <- batch
 
-				time.Sleep(interval + interval/2)
+				clk.Advance(elapsed)
+				<-cont.ticks
 			}
 			cancel()
 		}()
@@ -201,7 +216,7 @@ digraph {
     ingress -> 0 [label="16.00 req/s"];
     0 -> 1 [label="1.00"];
 }`
-	observeTest(expected, spans)(t)
+	observeTest(expected, spans, 50*time.Millisecond)(t)
 }
 
 func TestObserveIncompleteTrace(t *testing.T) {
@@ -240,7 +255,7 @@ digraph {
     ingress -> 0 [label="16.00 req/s"];
     0 -> 1 [label="1.00"];
 }`
-	observeTest(expected, spans)(t)
+	observeTest(expected, spans, 50*time.Millisecond)(t)
 }
 
 func TestObserveApproximationNoServiceName(t *testing.T) {
@@ -279,7 +294,7 @@ digraph {
     ingress -> 0 [label="16.00 req/s"];
     0 -> 1 [label="1.00"];
 }`
-	observeTest(expected, spans)(t)
+	observeTest(expected, spans, 50*time.Millisecond)(t)
 }
 
 func TestObserveIncompleteTraceNoServiceName(t *testing.T) {
@@ -326,7 +341,7 @@ digraph {
     ingress -> 0 [label="16.00 req/s"];
     0 -> 1 [label="1.00"];
 }`
-	observeTest(expected, spans)(t)
+	observeTest(expected, spans, 50*time.Millisecond)(t)
 }
 
 func TestObserveMultipleBatches(t *testing.T) {
@@ -403,8 +418,292 @@ digraph {
     ingress [label="ingress"];
     0 [shape=record,label="{service1|mu = 10000000.00 req/s}"];
     1 [shape=record,label="{service2|mu = 20000000.00 req/s}"];
-    ingress -> 0 [label="3.84 req/s"];
+    ingress -> 0 [label="19.20 req/s"];
+    0 -> 1 [label="1.00"];
+}`
+	observeTest(expected, spans, 50*time.Millisecond)(t)
+}
+
+func TestObserveElapsedTime(t *testing.T) {
+	spans := [][]*receiver.Span{{
+		{
+			Duration:    100,
+			Parent:      "",
+			ServiceName: "service1",
+			SpanId:      "span1",
+			StartTime:   0,
+			TraceId:     "trace1",
+		},
+		{
+			Duration:    50,
+			Parent:      "span1",
+			ServiceName: "service2",
+			SpanId:      "span2",
+			StartTime:   10,
+			TraceId:     "trace1",
+		},
+	}}
+
+	expected := `
+digraph {
+    ingress [label="ingress"];
+    0 [shape=record,label="{service1|mu = 10000000.00 req/s}"];
+    1 [shape=record,label="{service2|mu = 20000000.00 req/s}"];
+    ingress -> 0 [label="8.00 req/s"];
+    0 -> 1 [label="1.00"];
+}`
+	observeTest(expected, spans, 100*time.Millisecond)(t)
+}
+
+func TestObserveEventTime(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+	interval := time.Second
+	clk := clock.NewFake(start)
+	cont := &testController{fail: false, ticks: make(chan struct{})}
+	obs := observer.NewObserver(
+		observer.WithClock(clk),
+		observer.WithController(cont),
+		observer.WithEventTime(2*time.Second),
+		observer.WithInterval(interval))
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan receiver.Batch)
+
+	request := func(traceId string, at time.Duration) *receiver.Span {
+		return &receiver.Span{
+			Duration:    100,
+			Parent:      "",
+			ServiceName: "service1",
+			SpanId:      "span1",
+			StartTime:   uint64(start.Add(at).UnixNano()),
+			TraceId:     traceId,
+		}
+	}
+
+	estimates := []string{}
+	go func() {
+		for i := 0; i < 4; i++ {
+			if i == 2 {
+				// spans of the first window delivered late, in a single batch
+				batch := receiver.Batch{}
+				for j := 0; j < 10; j++ {
+					batch.Add(request(fmt.Sprintf("trace%d", j), 500*time.Millisecond))
+				}
+				ch <- batch
+			}
+
+			clk.Advance(interval)
+			<-cont.ticks
+			estimates = append(estimates, cont.queue.ToDOT())
+		}
+		cancel()
+	}()
+
+	obs.Observe(ctx, ch)
+	assert.Equal(t, "digraph {}", estimates[0])
+	assert.Equal(t, "digraph {}", estimates[1])
+	assert.Assert(t, strings.Contains(estimates[2], `ingress -> 0 [label="8.00 req/s"]`))
+	assert.Assert(t, strings.Contains(estimates[3], `ingress -> 0 [label="1.60 req/s"]`))
+	assert.Equal(t, uint(0), obs.State.LateRequests())
+}
+
+func TestObserveShards(t *testing.T) {
+	t.Parallel()
+
+	batch := receiver.Batch{}
+	for i := 0; i < 100; i++ {
+		traceId := fmt.Sprintf("trace%d", i)
+		batch.Add(&receiver.Span{
+			Duration:    100,
+			ServiceName: "service1",
+			SpanId:      "span1",
+			TraceId:     traceId,
+		})
+		batch.Add(&receiver.Span{
+			Duration:    50,
+			Parent:      "span1",
+			ServiceName: fmt.Sprintf("service%d", 2+i%3),
+			SpanId:      "span2",
+			TraceId:     traceId,
+		})
+	}
+
+	results := []string{}
+	for _, shards := range []int{1, 4} {
+		cont := &testController{fail: false, ticks: make(chan struct{})}
+		clk := clock.NewFake(time.Unix(0, 0))
+		obs := observer.NewObserver(
+			observer.WithClock(clk),
+			observer.WithController(cont),
+			observer.WithInterval(time.Second),
+			observer.WithShards(shards))
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := make(chan receiver.Batch)
+
+		go func() {
+			ch <- batch
+			clk.Advance(time.Second)
+			<-cont.ticks
+			cancel()
+		}()
+
+		obs.Observe(ctx, ch)
+		results = append(results, cont.queue.ToDOT())
+	}
+
+	assert.Assert(t, strings.Contains(results[0], `ingress -> 0 [label="80.00 req/s"]`))
+	assert.Equal(t, results[0], results[1])
+}
+
+type blockingController struct {
+	calls   chan *queue.QueueNetwork
+	release chan struct{}
+}
+
+func (b *blockingController) Stabilize(state *queue.QueueNetwork) error {
+	b.calls <- state
+	<-b.release
+
+	return nil
+}
+
+func TestObserveSlowController(t *testing.T) {
+	t.Parallel()
+
+	cont := &blockingController{
+		calls:   make(chan *queue.QueueNetwork),
+		release: make(chan struct{}),
+	}
+	clk := clock.NewFake(time.Unix(0, 0))
+	obs := observer.NewObserver(
+		observer.WithClock(clk),
+		observer.WithController(cont),
+		observer.WithInterval(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan receiver.Batch)
+
+	request := func(traceId string) receiver.Batch {
+		return receiver.Batch{traceId: {{
+			Duration:    100,
+			ServiceName: "service1",
+			SpanId:      "span1",
+			TraceId:     traceId,
+		}}}
+	}
+
+	var states []*queue.QueueNetwork
+	go func() {
+		defer cancel()
+
+		ch <- request("trace0")
+		clk.Advance(time.Second)
+		states = append(states, <-cont.calls)
+
+		// the controller is still busy, spans must keep flowing
+		for i := 1; i <= 10; i++ {
+			select {
+			case ch <- request(fmt.Sprintf("trace%d", i)):
+			case <-time.After(time.Second):
+				t.Error("ingestion blocked by a slow controller")
+				return
+			}
+		}
+
+		clk.Advance(time.Second)
+		close(cont.release)
+		states = append(states, <-cont.calls)
+	}()
+
+	obs.Observe(ctx, ch)
+	assert.Equal(t, 2, len(states))
+	assert.Assert(t, strings.Contains(states[0].ToDOT(), `ingress -> 0 [label="0.80 req/s"]`))
+	assert.Assert(t, strings.Contains(states[1].ToDOT(), `ingress -> 0 [label="8.16 req/s"]`))
+}
+
+func TestObserveSharedSpan(t *testing.T) {
+	spans := [][]*receiver.Span{{
+		{
+			Duration:    100,
+			Parent:      "",
+			ServiceName: "service1",
+			SpanId:      "span1",
+			StartTime:   0,
+			TraceId:     "trace1",
+		},
+		{
+			Duration:    80,
+			Parent:      "span1",
+			ServiceName: "service2",
+			SpanId:      "span1" + receiver.SharedSpanSuffix,
+			StartTime:   5,
+			TraceId:     "trace1",
+		},
+		{
+			Duration:    50,
+			Parent:      "span1",
+			ServiceName: "service3",
+			SpanId:      "span2",
+			StartTime:   10,
+			TraceId:     "trace1",
+		},
+	}}
+
+	expected := `
+digraph {
+    ingress [label="ingress"];
+    0 [shape=record,label="{service1|mu = 10000000.00 req/s}"];
+    1 [shape=record,label="{service2|mu = 12500000.00 req/s}"];
+    2 [shape=record,label="{service3|mu = 20000000.00 req/s}"];
+    ingress -> 0 [label="16.00 req/s"];
     0 -> 1 [label="1.00"];
+    1 -> 2 [label="1.00"];
 }`
-	observeTest(expected, spans)(t)
+	observeTest(expected, spans, 50*time.Millisecond)(t)
+}
+
+func TestObserveQueueLengthExpiry(t *testing.T) {
+	t.Parallel()
+
+	clk := clock.NewFake(time.Unix(0, 0))
+	obs := observer.NewObserver(
+		observer.WithClock(clk),
+		observer.WithQueueLengths(make(chan map[string]float64), 15*time.Second))
+	obs.Start()
+
+	obs.RecordQueueLengths(map[string]float64{"frontend": 3})
+	clk.Advance(10 * time.Second)
+	assert.NilError(t, obs.Tick())
+	assert.DeepEqual(t, obs.State.ObservedQueueLengths(), map[string]float64{"frontend": 3})
+
+	clk.Advance(10 * time.Second)
+	assert.NilError(t, obs.Tick())
+	assert.DeepEqual(t, obs.State.ObservedQueueLengths(), map[string]float64{})
+}
+
+func TestObserveRecordedBeforeStart(t *testing.T) {
+	t.Parallel()
+
+	cont := &testController{fail: false, ticks: make(chan struct{})}
+	obs := observer.NewObserver(
+		observer.WithController(cont),
+		observer.WithInterval(10*time.Millisecond))
+	obs.RecordBatch(receiver.Batch{"trace1": {{
+		Duration:    100,
+		ServiceName: "service1",
+		SpanId:      "span1",
+		TraceId:     "trace1",
+	}}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-cont.ticks
+		cancel()
+		for range cont.ticks {
+		}
+	}()
+	obs.Observe(ctx, make(chan receiver.Batch))
+	close(cont.ticks)
+
+	assert.Assert(t, strings.Contains(obs.State.ToDOT(), "service1"))
 }
@@ -1,26 +1,60 @@
 package observer
 
 import (
+	"runtime"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/clock"
 	"github.com/pako-23/queue-scaler/internal/controller"
 	"github.com/pako-23/queue-scaler/internal/queue"
-	"time"
+	"github.com/pako-23/queue-scaler/internal/receiver"
 )
 
 const DefaultInterval = 5 * time.Second
 
+// shardBuffer is the number of messages queued for each shard.
+const shardBuffer = 64
+
+type Recorder interface {
+	RecordMetrics(time.Time, *receiver.Metrics) error
+	RecordQueueLengths(time.Time, map[string]float64, time.Duration) error
+	RecordSpan(time.Time, *receiver.Span) error
+	RecordStart(time.Time) error
+	RecordTick(time.Time, time.Duration) error
+}
+
 type Observer struct {
-	Interval   time.Duration
-	State      *queue.QueueNetwork
-	controller controller.Controller
+	Interval       time.Duration
+	State          *queue.QueueNetwork
+	clock          clock.Clock
+	controller     controller.Controller
+	eventTime      bool
+	lastTick       time.Time
+	lateness       time.Duration
+	metrics        <-chan *receiver.Metrics
+	queueLengthAge time.Duration
+	queueLengths   <-chan map[string]float64
+	recorder       Recorder
+	running        bool
+	shardCount     int
+	shards         []*shard
+	windowStart    time.Time
 }
 
 type Option func(*Observer)
 
+// Controller is the controller stabilizing the model on every tick.
+func (o *Observer) Controller() controller.Controller {
+	return o.controller
+}
+
 func NewObserver(options ...Option) *Observer {
 	observer := &Observer{
 		Interval:   DefaultInterval,
 		State:      queue.NewQueueNetwork(),
+		clock:      clock.Real{},
 		controller: &controller.NullController{},
+		shardCount: runtime.GOMAXPROCS(0),
 	}
 
 	for _, opt := range options {
@@ -36,6 +70,51 @@ func WithController(cont controller.Controller) Option {
 	}
 }
 
+func WithClock(clk clock.Clock) Option {
+	return func(observer *Observer) {
+		observer.clock = clk
+	}
+}
+
+func WithEventTime(lateness time.Duration) Option {
+	return func(observer *Observer) {
+		observer.eventTime = true
+		observer.lateness = lateness
+	}
+}
+
+// WithMetrics adds the requests reported through metrics on ch to the model,
+// next to the ones assembled from traces.
+func WithMetrics(ch <-chan *receiver.Metrics) Option {
+	return func(observer *Observer) {
+		observer.metrics = ch
+	}
+}
+
+// WithQueueLengths records the queue lengths measured outside of the traces
+// received on ch. Each measurement replaces the previous one, and is
+// forgotten once older than maxAge.
+func WithQueueLengths(ch <-chan map[string]float64, maxAge time.Duration) Option {
+	return func(observer *Observer) {
+		observer.queueLengths = ch
+		observer.queueLengthAge = maxAge
+	}
+}
+
+func WithRecorder(recorder Recorder) Option {
+	return func(observer *Observer) {
+		observer.recorder = recorder
+	}
+}
+
+func WithShards(shards int) Option {
+	return func(observer *Observer) {
+		if shards > 0 {
+			observer.shardCount = shards
+		}
+	}
+}
+
 func WithInterval(interval time.Duration) Option {
 	return func(observer *Observer) {
 		observer.Interval = interval
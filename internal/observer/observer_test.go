@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/pako-23/queue-scaler/internal/clock"
 	"github.com/pako-23/queue-scaler/internal/controller"
 	"github.com/pako-23/queue-scaler/internal/observer"
 	"gotest.tools/v3/assert"
@@ -34,6 +35,13 @@ func TestObserverInit(t *testing.T) {
 		assert.Assert(t, obs.Interval == interval)
 	})
 
+	t.Run("with clock", func(t *testing.T) {
+		obs := observer.NewObserver(observer.WithClock(clock.NewFake(time.Unix(0, 0))))
+		assert.Assert(t, obs != nil)
+		assert.Assert(t, obs.State != nil)
+		assert.Assert(t, obs.Interval == observer.DefaultInterval)
+	})
+
 	t.Run("with interval and controller", func(t *testing.T) {
 		interval := observer.DefaultInterval + time.Second
 		obs := observer.NewObserver(
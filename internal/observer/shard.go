@@ -0,0 +1,70 @@
+package observer
+
+import (
+	"hash/fnv"
+
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+)
+
+// shardMessage carries either a batch of spans or a request to flush the
+// model delta accumulated by a shard since the previous flush. Both travel on
+// the same channel so that a flush always sees the batches sent before it.
+type shardMessage struct {
+	batch receiver.Batch
+	flush chan<- *queue.QueueNetwork
+}
+
+type shard struct {
+	delta    *queue.QueueNetwork
+	messages chan shardMessage
+	newDelta func() *queue.QueueNetwork
+	traces   map[string]trace
+}
+
+func newShard(newDelta func() *queue.QueueNetwork) *shard {
+	return &shard{
+		delta:    newDelta(),
+		newDelta: newDelta,
+		traces:   map[string]trace{},
+	}
+}
+
+func shardIndex(traceId string, shards int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(traceId))
+
+	return int(hash.Sum32() % uint32(shards))
+}
+
+func (s *shard) record(span *receiver.Span) {
+	if _, ok := s.traces[span.TraceId]; !ok {
+		s.traces[span.TraceId] = trace{}
+	}
+
+	s.traces[span.TraceId][span.SpanId] = span
+}
+
+func (s *shard) flush() *queue.QueueNetwork {
+	processTraces(s.delta, s.traces)
+
+	delta := s.delta
+	s.delta = s.newDelta()
+
+	return delta
+}
+
+func (s *shard) run() {
+	for message := range s.messages {
+		if message.flush != nil {
+			message.flush <- s.flush()
+			continue
+		}
+
+		for _, spans := range message.batch {
+			for _, span := range spans {
+				s.record(span)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package queue
+
+import (
+	"math"
+	"sort"
+)
+
+// latencyCosts returns how much a second of response time at every node adds
+// to the objective: the weighted rate at which requests entering at each
+// entry point visit the node. Entry points default to a weight of 1.
+func (q *QueueNetwork) latencyCosts(weights map[string]float64) map[string]float64 {
+	costs := make(map[string]float64, len(q.network))
+
+	for entry, rate := range q.ExternalRates() {
+		weight, ok := weights[entry]
+		if !ok {
+			weight = 1.0
+		}
+
+		for node, ratio := range q.VisitRatios(entry) {
+			costs[node] += weight * rate * ratio
+		}
+	}
+
+	return costs
+}
+
+// Allocate shares budget replicas among the nodes in demand, never giving a
+// node more than it demands, so as to minimize the weighted mean end-to-end
+// response time of the entry points. Starting from one replica each, the
+// next replica always goes to the node where it saves the most: unstable
+// nodes first, the ones weighing most on the entry points before others.
+// Once no replica saves anything, the rest of the budget goes towards the
+// demands in name order. Every node gets at least one replica, even beyond
+// the budget.
+func (q *QueueNetwork) Allocate(budget int32, demand map[string]int32, weights map[string]float64) map[string]int32 {
+	costs := q.latencyCosts(weights)
+	rates := q.IncomingRates()
+
+	nodes := make([]string, 0, len(demand))
+	allocation := make(map[string]int32, len(demand))
+	for node := range demand {
+		nodes = append(nodes, node)
+		allocation[node] = 1
+	}
+	sort.Strings(nodes)
+
+	responseTime := func(node string, replicas int32) float64 {
+		return q.AnalyzeNode(node, rates[node], replicas).ResponseTime
+	}
+
+	for remaining := budget - int32(len(nodes)); remaining > 0; remaining-- {
+		best, bestUnstable, bestGain := "", false, 0.0
+		for _, node := range nodes {
+			if allocation[node] >= demand[node] || costs[node] == 0.0 {
+				continue
+			}
+
+			current := responseTime(node, allocation[node])
+			unstable := math.IsInf(current, 1)
+			gain := costs[node]
+			if !unstable {
+				gain *= current - responseTime(node, allocation[node]+1)
+			}
+
+			if (unstable && !bestUnstable) || (unstable == bestUnstable && gain > bestGain) {
+				best, bestUnstable, bestGain = node, unstable, gain
+			}
+		}
+
+		for _, node := range nodes {
+			if best == "" && allocation[node] < demand[node] {
+				best = node
+			}
+		}
+
+		if best == "" {
+			break
+		}
+		allocation[best] += 1
+	}
+
+	return allocation
+}
@@ -0,0 +1,53 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAllocate(t *testing.T) {
+	t.Parallel()
+
+	// every request to frontend also visits backend, all at 100 req/s per
+	// replica
+	network := NewQueueNetwork()
+	assert.NilError(t, json.Unmarshal([]byte(`{
+		"admin": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 80, "totalRequests": 100},
+		"backend": {"durationSum": 1000000000, "requestCount": 100, "callers": {"frontend": 100}},
+		"frontend": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 80, "totalRequests": 100},
+		"worker": {"durationSum": 1000000000, "requestCount": 100}
+	}`), network))
+	demand := map[string]int32{"admin": 3, "backend": 3, "frontend": 3, "worker": 2}
+	weights := map[string]float64{"admin": 0.1}
+
+	for _, test := range []struct {
+		budget   int32
+		expected map[string]int32
+	}{
+		{budget: 2, expected: map[string]int32{"admin": 1, "backend": 1, "frontend": 1, "worker": 1}},
+		{budget: 5, expected: map[string]int32{"admin": 1, "backend": 2, "frontend": 1, "worker": 1}},
+		{budget: 6, expected: map[string]int32{"admin": 1, "backend": 2, "frontend": 2, "worker": 1}},
+		{budget: 7, expected: map[string]int32{"admin": 2, "backend": 2, "frontend": 2, "worker": 1}},
+		// worker serves no entry point and only gets what is left
+		{budget: 10, expected: map[string]int32{"admin": 3, "backend": 3, "frontend": 3, "worker": 1}},
+		{budget: 100, expected: map[string]int32{"admin": 3, "backend": 3, "frontend": 3, "worker": 2}},
+	} {
+		assert.DeepEqual(t, network.Allocate(test.budget, demand, weights), test.expected)
+	}
+}
+
+func TestAllocateUnstableFirst(t *testing.T) {
+	t.Parallel()
+
+	// admin needs 2 replicas to keep up, however little it weighs
+	network := NewQueueNetwork()
+	assert.NilError(t, json.Unmarshal([]byte(`{
+		"admin": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 150, "totalRequests": 100},
+		"frontend": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 80, "totalRequests": 100}
+	}`), network))
+
+	allocation := network.Allocate(3, map[string]int32{"admin": 4, "frontend": 4}, map[string]float64{"admin": 0.01})
+	assert.DeepEqual(t, allocation, map[string]int32{"admin": 2, "frontend": 1})
+}
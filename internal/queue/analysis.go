@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+type NodeAnalysis struct {
+	ArrivalRate float64
+	// Concurrency is how many requests a replica serves at once.
+	Concurrency float64
+	// InSystem is the mean number of requests queueing or being served.
+	InSystem float64
+	// Observed reports whether ObservedQueueLength was measured.
+	Observed            bool
+	ObservedQueueLength float64
+	// P50, P95 and P99 are percentiles of the observed durations, in
+	// seconds.
+	P50, P95, P99 float64
+	QueueLength   float64
+	Replicas      int32
+	ResponseTime  float64
+	// SCV is the squared coefficient of variation of the service times.
+	SCV         float64
+	ServiceRate float64
+	Utilization float64
+	WaitingTime float64
+}
+
+type Analysis struct {
+	Bottlenecks []string
+	EntryPoints map[string]float64
+	Nodes       map[string]*NodeAnalysis
+}
+
+// erlangC returns the probability that a request has to wait in an M/M/c
+// queue with the given offered load and number of servers.
+func erlangC(load float64, servers int32) float64 {
+	blocking := 1.0
+	for k := int32(1); k <= servers; k++ {
+		blocking = load * blocking / (float64(k) + load*blocking)
+	}
+
+	utilization := load / float64(servers)
+
+	return blocking / (1 - utilization*(1-blocking))
+}
+
+// analyzeNode models a node as an M/G/c queue whose servers are the requests
+// all of its replicas serve at once. Waiting times follow the Allen-Cunneen
+// approximation: the M/M/c ones scaled by (1+scv)/2 for Poisson arrivals.
+func analyzeNode(arrivalRate float64, serviceRate float64, replicas int32, concurrency float64, scv float64) *NodeAnalysis {
+	analysis := &NodeAnalysis{
+		ArrivalRate:  arrivalRate,
+		Concurrency:  concurrency,
+		QueueLength:  0.0,
+		Replicas:     replicas,
+		ResponseTime: 0.0,
+		SCV:          scv,
+		ServiceRate:  serviceRate,
+		Utilization:  0.0,
+	}
+
+	if serviceRate == 0.0 || arrivalRate == 0.0 {
+		return analysis
+	}
+
+	servers := max(replicas, int32(math.Floor(float64(replicas)*concurrency)))
+	load := arrivalRate / serviceRate
+	analysis.Utilization = load / float64(servers)
+	if analysis.Utilization >= 1.0 {
+		analysis.InSystem = math.Inf(1)
+		analysis.QueueLength = math.Inf(1)
+		analysis.ResponseTime = math.Inf(1)
+		analysis.WaitingTime = math.Inf(1)
+
+		return analysis
+	}
+
+	waiting := erlangC(load, servers)
+	analysis.QueueLength = waiting * analysis.Utilization / (1 - analysis.Utilization) * (1 + scv) / 2
+	analysis.InSystem = analysis.QueueLength + load
+	analysis.WaitingTime = analysis.QueueLength / arrivalRate
+	analysis.ResponseTime = analysis.WaitingTime + 1/serviceRate
+
+	return analysis
+}
+
+// Backlogged reports whether more requests were observed at the node than the
+// model predicts, by more than tolerance. The queue is then building up faster
+// than completed requests show.
+func (n *NodeAnalysis) Backlogged(tolerance float64) bool {
+	return n.Observed && n.ObservedQueueLength > n.InSystem+tolerance
+}
+
+func (q *QueueNetwork) VisitRatios(entry string) map[string]float64 {
+	return q.flows(q.incomingRequests(), func(node string) float64 {
+		if node == entry {
+			return 1.0
+		}
+
+		return 0.0
+	})
+}
+
+// AnalyzeNode predicts how node behaves when it receives arrivalRate requests
+// per second spread over the given replicas.
+func (q *QueueNetwork) AnalyzeNode(node string, arrivalRate float64, replicas int32) *NodeAnalysis {
+	serviceRate := q.ServiceRateAt(node, arrivalRate/float64(replicas))
+	analysis := analyzeNode(arrivalRate, serviceRate, replicas, q.Concurrency(node), q.SCV(node))
+
+	if histogram, ok := q.histograms[node]; ok {
+		analysis.P50 = histogram.Quantile(0.5)
+		analysis.P95 = histogram.Quantile(0.95)
+		analysis.P99 = histogram.Quantile(0.99)
+	}
+
+	if observed, ok := q.observed[node]; ok {
+		analysis.Observed = true
+		analysis.ObservedQueueLength = observed.length
+	}
+
+	return analysis
+}
+
+func (q *QueueNetwork) Analyze(replicas map[string]int32) *Analysis {
+	analysis := &Analysis{
+		Bottlenecks: make([]string, 0, len(q.network)),
+		EntryPoints: make(map[string]float64, len(q.incomingRates)),
+		Nodes:       make(map[string]*NodeAnalysis, len(q.network)),
+	}
+
+	for node, rate := range q.IncomingRates() {
+		count, ok := replicas[node]
+		if !ok || count < 1 {
+			count = 1
+		}
+
+		analysis.Nodes[node] = q.AnalyzeNode(node, rate, count)
+		analysis.Bottlenecks = append(analysis.Bottlenecks, node)
+	}
+
+	sort.Slice(analysis.Bottlenecks, func(i, j int) bool {
+		first := analysis.Nodes[analysis.Bottlenecks[i]]
+		second := analysis.Nodes[analysis.Bottlenecks[j]]
+		if first.Utilization != second.Utilization {
+			return first.Utilization > second.Utilization
+		}
+
+		return analysis.Bottlenecks[i] < analysis.Bottlenecks[j]
+	})
+
+	for entry := range q.incomingRates {
+		responseTime := 0.0
+		for node, ratio := range q.VisitRatios(entry) {
+			if ratio == 0.0 {
+				continue
+			}
+			responseTime += ratio * analysis.Nodes[node].ResponseTime
+		}
+		analysis.EntryPoints[entry] = responseTime
+	}
+
+	return analysis
+}
+
+func (a *Analysis) Report() string {
+	var builder strings.Builder
+
+	writer := tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NODE\tREPLICAS\tCONCURRENCY\tLAMBDA (req/s)\tMU (req/s)\tSCV\tP99 (ms)\tRHO\tQUEUE\tRESPONSE (ms)")
+	for _, node := range a.Bottlenecks {
+		details := a.Nodes[node]
+		fmt.Fprintf(writer, "%s\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\t%.2f\n",
+			node, details.Replicas, details.Concurrency, details.ArrivalRate, details.ServiceRate,
+			details.SCV, details.P99*1e3, details.Utilization, details.QueueLength, details.ResponseTime*1e3)
+	}
+	writer.Flush()
+
+	entries := make([]string, 0, len(a.EntryPoints))
+	for entry := range a.EntryPoints {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	builder.WriteString("\n")
+	writer = tabwriter.NewWriter(&builder, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ENTRY POINT\tRESPONSE (ms)")
+	for _, entry := range entries {
+		fmt.Fprintf(writer, "%s\t%.2f\n", entry, a.EntryPoints[entry]*1e3)
+	}
+	writer.Flush()
+
+	return builder.String()
+}
@@ -0,0 +1,220 @@
+package queue
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestErlangC(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		load     float64
+		servers  int32
+		expected float64
+	}{
+		{load: 0.5, servers: 1, expected: 0.5},
+		{load: 1.0, servers: 2, expected: 1.0 / 3.0},
+		{load: 0.0, servers: 3, expected: 0.0},
+	}
+
+	for _, test := range tests {
+		assert.Assert(t, compareFloats(erlangC(test.load, test.servers), test.expected, 10e-9))
+	}
+}
+
+func TestVisitRatios(t *testing.T) {
+	t.Parallel()
+
+	network := QueueNetwork{
+		NodeMetrics: map[string]*QueueMetric{
+			"node1": {durationSum: 100000000, requestCount: 100},
+			"node2": {durationSum: 3000000000, requestCount: 30},
+			"node3": {durationSum: 1000000000, requestCount: 70},
+			"node4": {durationSum: 2600000000, requestCount: 100},
+		},
+		incomingRates: map[string]*RateEstimator{
+			"node1": {
+				Estimate:      100.0,
+				totalRequests: 100,
+			},
+		},
+		network: map[string]map[string]uint{
+			"node1": {},
+			"node2": {"node1": 30},
+			"node3": {"node1": 70},
+			"node4": {"node2": 30, "node3": 70},
+		},
+	}
+
+	expected := map[string]float64{
+		"node1": 1.0,
+		"node2": 0.3,
+		"node3": 0.7,
+		"node4": 1.0,
+	}
+	assert.Assert(t, compareIncomingRates(expected, network.VisitRatios("node1")))
+
+	expected = map[string]float64{
+		"node1": 0.0,
+		"node2": 1.0,
+		"node3": 0.0,
+		"node4": 1.0,
+	}
+	assert.Assert(t, compareIncomingRates(expected, network.VisitRatios("node2")))
+}
+
+func TestCallCycle(t *testing.T) {
+	t.Parallel()
+
+	// every request to node1 calls node2, half of which call node1 back
+	network := QueueNetwork{
+		NodeMetrics: map[string]*QueueMetric{
+			"node1": {durationSum: 100000000, requestCount: 150},
+			"node2": {durationSum: 100000000, requestCount: 100},
+		},
+		incomingRates: map[string]*RateEstimator{
+			"node1": {
+				Estimate:      100.0,
+				totalRequests: 100,
+			},
+		},
+		network: map[string]map[string]uint{
+			"node1": {"node2": 50},
+			"node2": {"node1": 100},
+		},
+	}
+
+	expected := map[string]float64{"node1": 1.5, "node2": 1.0}
+	assert.Assert(t, compareIncomingRates(expected, network.VisitRatios("node1")))
+
+	expected = map[string]float64{"node1": 150.0, "node2": 100.0}
+	assert.Assert(t, compareIncomingRates(expected, network.IncomingRates()))
+}
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+
+	network := QueueNetwork{
+		NodeMetrics: map[string]*QueueMetric{
+			"node1": {durationSum: 500000000, requestCount: 100},
+			"node2": {durationSum: 1000000000, requestCount: 100},
+			"node3": {durationSum: 0, requestCount: 0},
+		},
+		incomingRates: map[string]*RateEstimator{
+			"node1": {
+				Estimate:      100.0,
+				totalRequests: 100,
+			},
+		},
+		network: map[string]map[string]uint{
+			"node1": {},
+			"node2": {"node1": 100},
+			"node3": {},
+		},
+	}
+
+	t.Run("stable network", func(t *testing.T) {
+		analysis := network.Analyze(map[string]int32{"node1": 1, "node2": 2})
+
+		assert.DeepEqual(t, []string{"node1", "node2", "node3"}, analysis.Bottlenecks)
+
+		assert.Equal(t, int32(1), analysis.Nodes["node1"].Replicas)
+		assert.Assert(t, compareFloats(analysis.Nodes["node1"].ArrivalRate, 100.0, 10e-9))
+		assert.Assert(t, compareFloats(analysis.Nodes["node1"].ServiceRate, 200.0, 10e-9))
+		assert.Assert(t, compareFloats(analysis.Nodes["node1"].Utilization, 0.5, 10e-9))
+		assert.Assert(t, compareFloats(analysis.Nodes["node1"].QueueLength, 0.5, 10e-9))
+		assert.Assert(t, compareFloats(analysis.Nodes["node1"].ResponseTime, 0.01, 10e-9))
+
+		assert.Equal(t, int32(2), analysis.Nodes["node2"].Replicas)
+		assert.Assert(t, compareFloats(analysis.Nodes["node2"].Utilization, 0.5, 10e-9))
+		assert.Assert(t, compareFloats(analysis.Nodes["node2"].QueueLength, 1.0/3.0, 10e-9))
+		assert.Assert(t, compareFloats(analysis.Nodes["node2"].ResponseTime, 0.04/3.0, 10e-9))
+
+		assert.Equal(t, int32(1), analysis.Nodes["node3"].Replicas)
+		assert.Assert(t, compareFloats(analysis.Nodes["node3"].Utilization, 0.0, 10e-9))
+		assert.Assert(t, compareFloats(analysis.Nodes["node3"].ResponseTime, 0.0, 10e-9))
+
+		assert.Equal(t, 1, len(analysis.EntryPoints))
+		assert.Assert(t, compareFloats(analysis.EntryPoints["node1"], 0.07/3.0, 10e-9))
+	})
+
+	t.Run("unstable node", func(t *testing.T) {
+		analysis := network.Analyze(map[string]int32{})
+
+		assert.DeepEqual(t, []string{"node2", "node1", "node3"}, analysis.Bottlenecks)
+		assert.Assert(t, compareFloats(analysis.Nodes["node2"].Utilization, 1.0, 10e-9))
+		assert.Assert(t, math.IsInf(analysis.Nodes["node2"].QueueLength, 1))
+		assert.Assert(t, math.IsInf(analysis.Nodes["node2"].ResponseTime, 1))
+		assert.Assert(t, math.IsInf(analysis.EntryPoints["node1"], 1))
+	})
+}
+
+func TestEmptyAnalysis(t *testing.T) {
+	t.Parallel()
+
+	analysis := NewQueueNetwork().Analyze(nil)
+	assert.Equal(t, 0, len(analysis.Nodes))
+	assert.Equal(t, 0, len(analysis.EntryPoints))
+	assert.Equal(t, 0, len(analysis.Bottlenecks))
+}
+
+func TestObservedQueueLength(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	network.AddNode("node1")
+	network.NodeMetrics["node1"] = &QueueMetric{durationSum: 1000000000, requestCount: 100}
+	network.incomingRates["node1"] = &RateEstimator{Estimate: 50.0, totalRequests: 100}
+	network.AddNode("node2")
+	observedAt := time.Unix(100, 0)
+	network.ObserveQueueLength("node1", 3, observedAt)
+
+	analysis := network.Analyze(map[string]int32{"node1": 1})
+	node := analysis.Nodes["node1"]
+	assert.Assert(t, node.Observed)
+	assert.Equal(t, node.ObservedQueueLength, 3.0)
+	assert.Assert(t, compareFloats(node.InSystem, 1.0, 10e-9))
+	assert.Assert(t, node.Backlogged(1.0))
+	assert.Assert(t, !node.Backlogged(2.0))
+	assert.Assert(t, !analysis.Nodes["node2"].Observed)
+	assert.Assert(t, !analysis.Nodes["node2"].Backlogged(0))
+
+	assert.DeepEqual(t, network.Clone().ObservedQueueLengths(), map[string]float64{"node1": 3})
+
+	data, err := network.MarshalJSON()
+	assert.NilError(t, err)
+	restored := NewQueueNetwork()
+	assert.NilError(t, restored.UnmarshalJSON(data))
+	assert.DeepEqual(t, restored.ObservedQueueLengths(), map[string]float64{"node1": 3})
+
+	// stale observations are forgotten
+	restored.ExpireQueueLengths(observedAt)
+	assert.DeepEqual(t, restored.ObservedQueueLengths(), map[string]float64{"node1": 3})
+	restored.ExpireQueueLengths(observedAt.Add(time.Second))
+	assert.DeepEqual(t, restored.ObservedQueueLengths(), map[string]float64{})
+	assert.Assert(t, !restored.Analyze(map[string]int32{"node1": 1}).Nodes["node1"].Observed)
+
+	// a new measurement replaces the previous one
+	network.ObserveQueueLengths(map[string]float64{"node2": 1}, observedAt.Add(time.Second))
+	assert.DeepEqual(t, network.ObservedQueueLengths(), map[string]float64{"node2": 1})
+}
+
+func TestAllenCunneen(t *testing.T) {
+	t.Parallel()
+
+	// M/M/1 at 80% utilization
+	exponential := analyzeNode(80.0, 100.0, 1, 1.0, 1.0)
+	assert.Assert(t, compareFloats(exponential.QueueLength, 3.2, 10e-9))
+	assert.Assert(t, compareFloats(exponential.WaitingTime, 0.04, 10e-9))
+
+	constant := analyzeNode(80.0, 100.0, 1, 1.0, 0.0)
+	assert.Assert(t, compareFloats(constant.QueueLength, 1.6, 10e-9))
+
+	heavyTailed := analyzeNode(80.0, 100.0, 1, 1.0, 3.0)
+	assert.Assert(t, compareFloats(heavyTailed.WaitingTime, 0.08, 10e-9))
+	assert.Assert(t, compareFloats(heavyTailed.ResponseTime, 0.09, 10e-9))
+}
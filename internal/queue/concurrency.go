@@ -0,0 +1,235 @@
+package queue
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+)
+
+const (
+	// minLevelRequests is how many requests must have started at a
+	// concurrency level before their durations are trusted.
+	minLevelRequests = 10
+
+	// maxPodIntervals bounds the spans kept for every pod while waiting for
+	// the spans that overlap them.
+	maxPodIntervals = 1024
+
+	// maxPodBuffer bounds the spans of every pod waiting to be settled.
+	// Spans beyond it are left out of the levels.
+	maxPodBuffer = 16 * maxPodIntervals
+)
+
+type interval struct {
+	end     uint64
+	settled bool
+	start   uint64
+}
+
+// concurrency groups the durations of the requests served by a node by how
+// many requests the serving pod was busy with when they started, including
+// themselves.
+type concurrency struct {
+	levels map[int]*QueueMetric
+	pods   map[string][]interval
+}
+
+func newConcurrency() *concurrency {
+	return &concurrency{
+		levels: map[int]*QueueMetric{},
+		pods:   map[string][]interval{},
+	}
+}
+
+func (c *concurrency) add(pod string, start uint64, duration uint64) {
+	if len(c.pods[pod]) < maxPodBuffer {
+		c.pods[pod] = append(c.pods[pod], interval{end: start + duration, start: start})
+	}
+}
+
+func (c *concurrency) merge(delta *concurrency) {
+	for level, metric := range delta.levels {
+		c.addLevel(level, metric.durationSum, metric.requestCount)
+	}
+
+	for pod, intervals := range delta.pods {
+		room := max(maxPodBuffer-len(c.pods[pod]), 0)
+		c.pods[pod] = append(c.pods[pod], intervals[:min(room, len(intervals))]...)
+	}
+}
+
+// ends is a min-heap of the ends of the spans in progress.
+type ends []uint64
+
+func (e ends) Len() int           { return len(e) }
+func (e ends) Less(i, j int) bool { return e[i] < e[j] }
+func (e ends) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e *ends) Push(x any)        { *e = append(*e, x.(uint64)) }
+
+func (e *ends) Pop() any {
+	old := *e
+	end := old[len(old)-1]
+	*e = old[:len(old)-1]
+
+	return end
+}
+
+func (c *concurrency) addLevel(level int, durationSum uint64, requestCount uint64) {
+	if _, ok := c.levels[level]; !ok {
+		c.levels[level] = &QueueMetric{}
+	}
+	c.levels[level].durationSum += durationSum
+	c.levels[level].requestCount += requestCount
+}
+
+// settle assigns a level to the spans of every pod once a span starting after
+// their end was seen: the spans overlapping them are then assumed to be
+// known.
+func (c *concurrency) settle() {
+	for pod, intervals := range c.pods {
+		sort.Slice(intervals, func(i, j int) bool {
+			return intervals[i].start < intervals[j].start
+		})
+
+		latest := intervals[len(intervals)-1].start
+		forced := len(intervals) - maxPodIntervals
+		horizon := latest
+
+		// sweep the spans by start, keeping the ends of the ones in
+		// progress: the spans starting together all see each other
+		inProgress := &ends{}
+		for first := 0; first < len(intervals); {
+			start := intervals[first].start
+			last := first
+			for ; last < len(intervals) && intervals[last].start == start; last++ {
+				heap.Push(inProgress, intervals[last].end)
+			}
+			for inProgress.Len() > 0 && (*inProgress)[0] <= start {
+				heap.Pop(inProgress)
+			}
+
+			for i := first; i < last; i++ {
+				if intervals[i].settled {
+					continue
+				}
+				if intervals[i].end > latest && i >= forced {
+					horizon = min(horizon, intervals[i].start)
+					continue
+				}
+
+				level := 1 + inProgress.Len()
+				if intervals[i].end > start {
+					level--
+				}
+
+				c.addLevel(level, intervals[i].end-intervals[i].start, 1)
+				intervals[i].settled = true
+			}
+			first = last
+		}
+
+		kept := intervals[:0]
+		for _, span := range intervals {
+			if !span.settled || span.end > horizon {
+				kept = append(kept, span)
+			}
+		}
+		if len(kept) > maxPodIntervals {
+			kept = kept[len(kept)-maxPodIntervals:]
+		}
+
+		if len(kept) == 0 {
+			delete(c.pods, pod)
+		} else {
+			c.pods[pod] = kept
+		}
+	}
+}
+
+// estimate returns how many requests a pod serves at once and how long a
+// request takes when served alone, in seconds. Requests are assumed to share
+// the capacity of the pod once they exceed its concurrency, so that at level
+// k they take k/concurrency times longer. The lowest level observed is taken
+// as not slowed down.
+func (c *concurrency) estimate() (float64, float64, bool) {
+	levels := make([]int, 0, len(c.levels))
+	for level, metric := range c.levels {
+		if metric.requestCount >= minLevelRequests {
+			levels = append(levels, level)
+		}
+	}
+	if len(levels) == 0 {
+		return 0.0, 0.0, false
+	}
+	sort.Ints(levels)
+
+	base := 1.0 / c.levels[levels[0]].ServiceRate()
+	if base == 0.0 {
+		return 0.0, 0.0, false
+	}
+
+	estimate := 1.0
+	for _, level := range levels {
+		duration := 1.0 / c.levels[level].ServiceRate()
+		estimate = math.Max(estimate, math.Min(float64(level), float64(level)*base/duration))
+	}
+
+	return estimate, base, true
+}
+
+func (q *QueueNetwork) nodeConcurrency(node string) *concurrency {
+	if q.concurrency == nil {
+		q.concurrency = map[string]*concurrency{}
+	}
+	if _, ok := q.concurrency[node]; !ok {
+		q.concurrency[node] = newConcurrency()
+	}
+
+	return q.concurrency[node]
+}
+
+// SettleConcurrency compares the spans each pod served to the spans
+// overlapping them. Since spans are split among deltas by trace, it has to
+// wait until the deltas holding them all are merged.
+func (q *QueueNetwork) SettleConcurrency() {
+	for _, levels := range q.concurrency {
+		levels.settle()
+	}
+}
+
+// Concurrency estimates how many requests a replica of node serves at once
+// before they slow each other down, from the spans overlapping on the same
+// pod. Without enough spans tagged with their pod, a replica serves one
+// request at a time.
+func (q *QueueNetwork) Concurrency(node string) float64 {
+	if levels, ok := q.concurrency[node]; ok {
+		if estimate, _, ok := levels.estimate(); ok {
+			return estimate
+		}
+	}
+
+	return 1.0
+}
+
+// ServiceRate is the rate at which a replica of node serves a single request
+// when it is not slowed down by others.
+func (q *QueueNetwork) ServiceRate(node string) float64 {
+	if levels, ok := q.concurrency[node]; ok {
+		if _, base, ok := levels.estimate(); ok {
+			return 1.0 / base
+		}
+	}
+
+	metric, ok := q.NodeMetrics[node]
+	if !ok {
+		return 0.0
+	}
+
+	return metric.ServiceRate()
+}
+
+// ReplicaRate is the throughput of a replica of node serving as many
+// requests as its concurrency allows.
+func (q *QueueNetwork) ReplicaRate(node string) float64 {
+	return q.Concurrency(node) * q.ServiceRate(node)
+}
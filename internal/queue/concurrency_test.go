@@ -0,0 +1,106 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestConcurrency(t *testing.T) {
+	t.Parallel()
+
+	// a pod serving 4 requests at once in 100ms each, sharing its capacity
+	// beyond that
+	first, second := NewQueueNetwork(), NewQueueNetwork()
+	start := uint64(0)
+	for level := 1; level <= 8; level++ {
+		duration := uint64(100e6)
+		if level > 4 {
+			duration = duration * uint64(level) / 4
+		}
+
+		for round := 0; round < minLevelRequests; round++ {
+			for i := 0; i < level; i++ {
+				delta := first
+				if i%2 == 1 {
+					delta = second
+				}
+				delta.AddExternalRequest(&receiver.Span{
+					Duration:    duration,
+					Pod:         "frontend-1",
+					ServiceName: "frontend",
+					SpanId:      fmt.Sprintf("%d-%d-%d", level, round, i),
+					StartTime:   start,
+				})
+			}
+			start += 1e9
+		}
+	}
+	first.AddExternalRequest(&receiver.Span{Duration: 1, Pod: "frontend-1", ServiceName: "frontend", StartTime: start})
+
+	network := NewQueueNetwork()
+	network.Merge(first)
+	network.Merge(second)
+	network.SettleConcurrency()
+
+	assert.Assert(t, compareFloats(network.Concurrency("frontend"), 4.0, 10e-9))
+	assert.Assert(t, compareFloats(network.ServiceRate("frontend"), 10.0, 10e-9))
+	assert.Assert(t, compareFloats(network.ReplicaRate("frontend"), 40.0, 10e-9))
+
+	clone := network.Clone()
+	assert.Assert(t, compareFloats(clone.ReplicaRate("frontend"), 40.0, 10e-9))
+
+	data, err := network.MarshalJSON()
+	assert.NilError(t, err)
+	restored := NewQueueNetwork()
+	assert.NilError(t, restored.UnmarshalJSON(data))
+	assert.Assert(t, compareFloats(restored.ReplicaRate("frontend"), 40.0, 10e-9))
+}
+
+func TestConcurrencyWithoutPods(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	for i := 0; i < 2*minLevelRequests; i++ {
+		network.AddExternalRequest(&receiver.Span{Duration: 200e6, ServiceName: "frontend", StartTime: 0})
+	}
+	network.SettleConcurrency()
+
+	assert.Assert(t, compareFloats(network.Concurrency("frontend"), 1.0, 10e-9))
+	assert.Assert(t, compareFloats(network.ReplicaRate("frontend"), 5.0, 10e-9))
+	assert.Assert(t, compareFloats(network.ReplicaRate("backend"), 0.0, 10e-9))
+}
+
+func TestConcurrencyBoundedIntervals(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	for i := 0; i < 2*maxPodIntervals; i++ {
+		// never ending spans are only settled when too many are waiting
+		network.AddExternalRequest(&receiver.Span{Duration: 1e15, Pod: "frontend-1", ServiceName: "frontend", StartTime: uint64(i)})
+	}
+	network.SettleConcurrency()
+
+	assert.Equal(t, len(network.concurrency["frontend"].pods["frontend-1"]), maxPodIntervals)
+}
+
+func TestConcurrencyBoundedBuffer(t *testing.T) {
+	t.Parallel()
+
+	c := newConcurrency()
+	for i := 0; i < maxPodBuffer+10; i++ {
+		c.add("frontend-1", uint64(i), 1)
+	}
+	assert.Equal(t, len(c.pods["frontend-1"]), maxPodBuffer)
+
+	delta := newConcurrency()
+	delta.add("frontend-1", 0, 1)
+	c.merge(delta)
+	assert.Equal(t, len(c.pods["frontend-1"]), maxPodBuffer)
+
+	// back to back spans never overlap
+	c.settle()
+	assert.Equal(t, c.levels[1].requestCount, uint64(maxPodBuffer-1))
+}
@@ -0,0 +1,112 @@
+package queue
+
+import "math"
+
+// confidenceZ is the standard normal quantile of 95% confidence intervals.
+const confidenceZ = 1.96
+
+// Confidence is an estimate with its 95% confidence interval and the number
+// of requests it is based on.
+type Confidence struct {
+	Estimate float64
+	Lower    float64
+	Samples  uint64
+	Upper    float64
+}
+
+// RelativeWidth is the width of the interval relative to the estimate.
+func (c Confidence) RelativeWidth() float64 {
+	width := c.Upper - c.Lower
+	if width == 0.0 {
+		return 0.0
+	}
+	if c.Estimate == 0.0 {
+		return math.Inf(1)
+	}
+
+	return width / c.Estimate
+}
+
+// effectiveRequests is how many requests the moving average is worth: the
+// effective number of intervals (Σw)²/Σw² times the rate Estimate/Σw, so that
+// traffic stops counting as its weight fades away.
+func (r *RateEstimator) effectiveRequests() float64 {
+	if r.weightSquares == 0.0 {
+		return 0.0
+	}
+
+	return r.Estimate * r.weightSum / r.weightSquares
+}
+
+// Confidence treats the estimate as a Poisson count over the exposure time
+// equivalent to the weights of the moving average, with a score interval.
+func (r *RateEstimator) Confidence() Confidence {
+	confidence := Confidence{
+		Estimate: r.Estimate,
+		Lower:    0.0,
+		Samples:  uint64(math.Round(r.effectiveRequests())),
+		Upper:    math.Inf(1),
+	}
+	if r.weightSquares == 0.0 {
+		return confidence
+	}
+
+	exposure := 1.0 / r.weightSquares
+	count := r.Estimate * exposure
+	center := count + confidenceZ*confidenceZ/2
+	half := confidenceZ * math.Sqrt(count+confidenceZ*confidenceZ/4)
+	confidence.Lower = math.Max(0.0, (center-half)/exposure)
+	confidence.Upper = (center + half) / exposure
+
+	return confidence
+}
+
+// IncomingRateIntervals bounds the incoming rates of every node by
+// propagating the bounds of the external rates through the network, and so
+// are the requests they are based on. The routing probabilities are taken as
+// exact.
+func (q *QueueNetwork) IncomingRateIntervals() map[string]Confidence {
+	incomingRequests := q.incomingRequests()
+	lower := q.propagate(incomingRequests, func(r *RateEstimator) float64 {
+		return r.Confidence().Lower
+	})
+	samples := q.propagate(incomingRequests, func(r *RateEstimator) float64 {
+		return r.effectiveRequests()
+	})
+	upper := q.propagate(incomingRequests, func(r *RateEstimator) float64 {
+		return r.Confidence().Upper
+	})
+	estimates := q.IncomingRates()
+
+	intervals := make(map[string]Confidence, len(q.network))
+	for node := range q.network {
+		intervals[node] = Confidence{
+			Estimate: estimates[node],
+			Lower:    lower[node],
+			Samples:  uint64(math.Round(samples[node])),
+			Upper:    upper[node],
+		}
+	}
+
+	return intervals
+}
+
+// ServiceTimeConfidence bounds the mean duration in seconds of the requests
+// node served with the central limit theorem, using the variability of the
+// durations observed through spans.
+func (q *QueueNetwork) ServiceTimeConfidence(node string) Confidence {
+	metric, ok := q.NodeMetrics[node]
+	if !ok || metric.requestCount == 0 {
+		return Confidence{Upper: math.Inf(1)}
+	}
+
+	mean := float64(metric.durationSum) / 1e9 / float64(metric.requestCount)
+	half := confidenceZ * mean * math.Sqrt(q.SCV(node)/float64(metric.requestCount))
+
+	return Confidence{
+		Estimate: mean,
+		Lower:    math.Max(0.0, mean-half),
+		Samples:  metric.requestCount,
+		Upper:    mean + half,
+	}
+}
@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestRateConfidence(t *testing.T) {
+	t.Parallel()
+
+	estimator := &RateEstimator{totalRequests: 100}
+	confidence := estimator.Confidence()
+	assert.Assert(t, math.IsInf(confidence.Upper, 1))
+	assert.Assert(t, math.IsInf(confidence.RelativeWidth(), 1))
+
+	estimator.latestRequests = 100
+	estimator.Update(time.Second)
+
+	// 80 req/s over an exposure of 1/0.64 s
+	confidence = estimator.Confidence()
+	assert.Equal(t, confidence.Samples, uint64(100))
+	assert.Assert(t, compareFloats(confidence.Estimate, 80.0, 10e-9))
+	assert.Assert(t, compareFloats(confidence.Lower, 67.1509, 10e-4))
+	assert.Assert(t, compareFloats(confidence.Upper, 95.3077, 10e-4))
+
+	// the interval narrows relative to the estimate as traffic grows
+	busy := &RateEstimator{}
+	quiet := &RateEstimator{}
+	for i := 0; i < 10; i++ {
+		busy.latestRequests = 1000
+		busy.Update(time.Second)
+		quiet.latestRequests = 2
+		quiet.Update(time.Second)
+	}
+	assert.Assert(t, busy.Confidence().RelativeWidth() < 0.2)
+	assert.Assert(t, quiet.Confidence().RelativeWidth() > 1.0)
+
+	// past traffic stops counting as it fades from the average
+	assert.Equal(t, busy.Confidence().Samples, uint64(1500))
+	for i := 0; i < 10; i++ {
+		busy.latestRequests = 2
+		busy.Update(time.Second)
+	}
+	assert.Equal(t, busy.Confidence().Samples, uint64(3))
+}
+
+func TestIncomingRateIntervals(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	for i := 0; i < 100; i++ {
+		request := &receiver.Span{Duration: 10e6, ServiceName: "frontend"}
+		network.AddExternalRequest(request)
+		if i%2 == 0 {
+			network.AddInternalRequest(request, &receiver.Span{Duration: 10e6, ServiceName: "backend"})
+		}
+	}
+	network.UpdateEstimates(time.Second)
+
+	intervals := network.IncomingRateIntervals()
+	frontend, backend := intervals["frontend"], intervals["backend"]
+	assert.Equal(t, frontend.Samples, uint64(100))
+	assert.Equal(t, backend.Samples, uint64(50))
+	assert.Assert(t, compareFloats(backend.Estimate, frontend.Estimate/2, 10e-9))
+	assert.Assert(t, compareFloats(backend.Lower, frontend.Lower/2, 10e-9))
+	assert.Assert(t, compareFloats(backend.Upper, frontend.Upper/2, 10e-9))
+}
+
+func TestServiceTimeConfidence(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	confidence := network.ServiceTimeConfidence("frontend")
+	assert.Assert(t, math.IsInf(confidence.Upper, 1))
+
+	// an SCV of 1
+	for i := 0; i < 50; i++ {
+		network.AddExternalRequest(&receiver.Span{Duration: 0, ServiceName: "frontend"})
+		network.AddExternalRequest(&receiver.Span{Duration: 20e6, ServiceName: "frontend"})
+	}
+
+	confidence = network.ServiceTimeConfidence("frontend")
+	assert.Equal(t, confidence.Samples, uint64(100))
+	assert.Assert(t, compareFloats(confidence.Estimate, 0.01, 10e-9))
+	assert.Assert(t, compareFloats(confidence.Lower, 0.00804, 10e-9))
+	assert.Assert(t, compareFloats(confidence.Upper, 0.01196, 10e-9))
+	assert.Assert(t, compareFloats(confidence.RelativeWidth(), 0.392, 10e-9))
+}
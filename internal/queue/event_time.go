@@ -0,0 +1,66 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+)
+
+type eventWindows struct {
+	closed int64
+	counts map[string]map[int64]uint
+	late   uint
+	size   time.Duration
+	start  time.Time
+}
+
+func (q *QueueNetwork) UseEventTime(start time.Time, size time.Duration) {
+	q.windows = &eventWindows{
+		closed: 0,
+		counts: map[string]map[int64]uint{},
+		late:   0,
+		size:   size,
+		start:  start,
+	}
+}
+
+func (e *eventWindows) add(request *receiver.Span) {
+	offset := time.Unix(0, int64(request.StartTime)).Sub(e.start)
+	index := int64(offset / e.size)
+	if offset < 0 || index < e.closed {
+		e.late += 1
+		return
+	}
+
+	e.addCount(request.ServiceName, index, 1)
+}
+
+func (e *eventWindows) addCount(node string, index int64, count uint) {
+	if _, ok := e.counts[node]; !ok {
+		e.counts[node] = map[int64]uint{}
+	}
+	e.counts[node][index] += count
+}
+
+func (q *QueueNetwork) CloseWindows(watermark time.Time) {
+	if q.windows == nil || watermark.Before(q.windows.start) {
+		return
+	}
+
+	complete := int64(watermark.Sub(q.windows.start) / q.windows.size)
+	for ; q.windows.closed < complete; q.windows.closed++ {
+		for node, estimator := range q.incomingRates {
+			estimator.latestRequests = q.windows.counts[node][q.windows.closed]
+			estimator.Update(q.windows.size)
+			delete(q.windows.counts[node], q.windows.closed)
+		}
+	}
+}
+
+func (q *QueueNetwork) LateRequests() uint {
+	if q.windows == nil {
+		return 0
+	}
+
+	return q.windows.late
+}
@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestEventTimeWindows(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+	network := NewQueueNetwork()
+	network.UseEventTime(start, time.Second)
+
+	request := func(service string, at time.Duration) *receiver.Span {
+		return &receiver.Span{
+			Duration:    1000,
+			ServiceName: service,
+			StartTime:   uint64(start.Add(at).UnixNano()),
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		network.AddExternalRequest(request("node1", 100*time.Millisecond))
+	}
+	for i := 0; i < 5; i++ {
+		network.AddExternalRequest(request("node1", 1500*time.Millisecond))
+		network.AddExternalRequest(request("node2", 1500*time.Millisecond))
+	}
+	network.AddExternalRequest(request("node1", -time.Millisecond))
+
+	assert.Equal(t, uint(0), network.incomingRates["node1"].latestRequests)
+	assert.Equal(t, uint(16), network.incomingRates["node1"].totalRequests)
+	assert.Equal(t, uint(1), network.LateRequests())
+
+	network.CloseWindows(start.Add(-time.Second))
+	network.CloseWindows(start.Add(999 * time.Millisecond))
+	assert.Assert(t, compareEstimates(map[string]float64{"node1": 0.0, "node2": 0.0}, network))
+
+	network.CloseWindows(start.Add(time.Second))
+	assert.Assert(t, compareEstimates(map[string]float64{"node1": 8.0, "node2": 0.0}, network))
+
+	network.AddExternalRequest(request("node2", 500*time.Millisecond))
+	assert.Equal(t, uint(2), network.LateRequests())
+
+	network.CloseWindows(start.Add(3 * time.Second))
+	assert.Assert(t, compareEstimates(map[string]float64{"node1": 0.2*0.2*8.0 + 0.2*4.0, "node2": 0.2 * 4.0}, network))
+}
+
+func TestArrivalTimeLateRequests(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	network.AddExternalRequest(&receiver.Span{ServiceName: "node1"})
+	network.CloseWindows(time.Now())
+	assert.Equal(t, uint(0), network.LateRequests())
+	assert.Equal(t, uint(1), network.incomingRates["node1"].latestRequests)
+}
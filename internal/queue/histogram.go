@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"math"
+	"sort"
+)
+
+// histogramAccuracy is the relative error of the quantiles of a Histogram.
+const histogramAccuracy = 0.01
+
+var histogramGamma = (1 + histogramAccuracy) / (1 - histogramAccuracy)
+
+// Histogram is a mergeable sketch of the distribution of request durations.
+// Durations are counted in logarithmic buckets, so that quantiles have a
+// bounded relative error. Moments are kept exactly.
+type Histogram struct {
+	buckets    map[int]uint64
+	count      uint64
+	sum        float64
+	sumSquares float64
+	zeros      uint64
+}
+
+func NewHistogram() *Histogram {
+	return &Histogram{buckets: map[int]uint64{}}
+}
+
+// Add counts a duration in nanoseconds.
+func (h *Histogram) Add(duration uint64) {
+	h.count += 1
+	seconds := float64(duration) / 1e9
+	h.sum += seconds
+	h.sumSquares += seconds * seconds
+
+	if duration == 0 {
+		h.zeros += 1
+		return
+	}
+	h.buckets[int(math.Ceil(math.Log(seconds)/math.Log(histogramGamma)))] += 1
+}
+
+func (h *Histogram) Merge(other *Histogram) {
+	for index, count := range other.buckets {
+		h.buckets[index] += count
+	}
+	h.count += other.count
+	h.sum += other.sum
+	h.sumSquares += other.sumSquares
+	h.zeros += other.zeros
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.count
+}
+
+// Mean returns the mean duration in seconds.
+func (h *Histogram) Mean() float64 {
+	if h.count == 0 {
+		return 0.0
+	}
+
+	return h.sum / float64(h.count)
+}
+
+// Quantile returns the duration in seconds below which the given fraction of
+// the durations fall.
+func (h *Histogram) Quantile(quantile float64) float64 {
+	if h.count == 0 {
+		return 0.0
+	}
+
+	rank := uint64(math.Ceil(math.Max(0.0, math.Min(1.0, quantile)) * float64(h.count)))
+	if rank <= h.zeros {
+		return 0.0
+	}
+
+	indexes := make([]int, 0, len(h.buckets))
+	for index := range h.buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	seen := h.zeros
+	for _, index := range indexes {
+		seen += h.buckets[index]
+		if seen >= rank {
+			return 2 * math.Pow(histogramGamma, float64(index)) / (histogramGamma + 1)
+		}
+	}
+
+	if len(indexes) == 0 {
+		return 0.0
+	}
+
+	return 2 * math.Pow(histogramGamma, float64(indexes[len(indexes)-1])) / (histogramGamma + 1)
+}
+
+// SCV returns the squared coefficient of variation of the durations: 1 for
+// exponentially distributed durations, 0 for constant ones.
+func (h *Histogram) SCV() float64 {
+	mean := h.Mean()
+	if h.count < 2 || mean == 0.0 {
+		return 1.0
+	}
+
+	variance := h.sumSquares/float64(h.count) - mean*mean
+
+	return math.Max(0.0, variance) / (mean * mean)
+}
+
+func (q *QueueNetwork) histogram(node string) *Histogram {
+	if q.histograms == nil {
+		q.histograms = map[string]*Histogram{}
+	}
+	if _, ok := q.histograms[node]; !ok {
+		q.histograms[node] = NewHistogram()
+	}
+
+	return q.histograms[node]
+}
+
+// Histogram returns the distribution of the durations of the requests node
+// served, or nil if none was observed through spans.
+func (q *QueueNetwork) Histogram(node string) *Histogram {
+	return q.histograms[node]
+}
+
+// SCV returns the squared coefficient of variation of the service times of
+// node, taken as exponential until durations are observed.
+func (q *QueueNetwork) SCV(node string) float64 {
+	if histogram, ok := q.histograms[node]; ok {
+		return histogram.SCV()
+	}
+
+	return 1.0
+}
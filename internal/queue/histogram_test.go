@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestHistogramQuantiles(t *testing.T) {
+	t.Parallel()
+
+	first, second := NewHistogram(), NewHistogram()
+	for i := uint64(1); i <= 1000; i++ {
+		if i%2 == 0 {
+			first.Add(i * 1e6)
+		} else {
+			second.Add(i * 1e6)
+		}
+	}
+	first.Merge(second)
+
+	assert.Equal(t, first.Count(), uint64(1000))
+	assert.Assert(t, compareFloats(first.Mean(), 0.5005, 10e-9))
+	for _, test := range []struct {
+		quantile float64
+		expected float64
+	}{
+		{quantile: 0.5, expected: 0.5},
+		{quantile: 0.95, expected: 0.95},
+		{quantile: 0.99, expected: 0.99},
+		{quantile: 1.0, expected: 1.0},
+	} {
+		value := first.Quantile(test.quantile)
+		assert.Assert(t, compareFloats(value, test.expected, test.expected*histogramAccuracy),
+			"quantile %f: %f", test.quantile, value)
+	}
+}
+
+func TestHistogramSCV(t *testing.T) {
+	t.Parallel()
+
+	constant := NewHistogram()
+	for i := 0; i < 10; i++ {
+		constant.Add(10e6)
+	}
+	assert.Assert(t, compareFloats(constant.SCV(), 0.0, 10e-9))
+
+	// half the requests are instantaneous, half take 20ms
+	bimodal := NewHistogram()
+	for i := 0; i < 10; i++ {
+		bimodal.Add(0)
+		bimodal.Add(20e6)
+	}
+	assert.Assert(t, compareFloats(bimodal.SCV(), 1.0, 10e-9))
+	assert.Assert(t, compareFloats(bimodal.Quantile(0.5), 0.0, 10e-9))
+
+	assert.Assert(t, compareFloats(NewHistogram().SCV(), 1.0, 10e-9))
+}
+
+func TestNetworkHistogram(t *testing.T) {
+	t.Parallel()
+
+	delta := NewQueueNetwork()
+	for _, duration := range []uint64{10e6, 10e6, 40e6} {
+		delta.AddExternalRequest(&receiver.Span{Duration: duration, ServiceName: "frontend"})
+	}
+	network := NewQueueNetwork()
+	network.Merge(delta)
+
+	assert.Assert(t, network.Histogram("backend") == nil)
+	assert.Assert(t, compareFloats(network.SCV("backend"), 1.0, 10e-9))
+	assert.Assert(t, compareFloats(network.SCV("frontend"), 0.5, 10e-9))
+
+	data, err := json.Marshal(network)
+	assert.NilError(t, err)
+	restored := NewQueueNetwork()
+	assert.NilError(t, json.Unmarshal(data, restored))
+	assert.Assert(t, compareFloats(restored.SCV("frontend"), 0.5, 10e-9))
+	assert.Assert(t, compareFloats(restored.Histogram("frontend").Quantile(0.99),
+		network.Histogram("frontend").Quantile(0.99), 10e-9))
+}
@@ -1,6 +1,9 @@
 package queue
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 func (q *QueueNetwork) incomingRequests() map[string]uint {
 	incomingRequests := make(map[string]uint, len(q.network)+len(q.incomingRates))
@@ -21,26 +24,54 @@ func (q *QueueNetwork) incomingRequests() map[string]uint {
 	return incomingRequests
 }
 
-func (q *QueueNetwork) incomingRate(node string, requests map[string]uint, rates map[string]float64) float64 {
-	rate := 0.0
-
-	if estimator, ok := q.incomingRates[node]; ok {
-		rate += estimator.Estimate
+// maxFlowIterations bounds the passes over the network when calls form
+// cycles whose flows never settle.
+const maxFlowIterations = 1000
+
+// flows solves the traffic equations of the network: the flow of every node
+// is its external flow, as given by external, plus the flows of its callers
+// weighted by their routing probabilities. The equations are iterated to a
+// fixed point, so that calls forming cycles are handled as well; without
+// cycles, this takes as many passes as the longest chain of calls.
+func (q *QueueNetwork) flows(requests map[string]uint, external func(node string) float64) map[string]float64 {
+	flows := make(map[string]float64, len(q.network))
+	for node := range q.network {
+		flows[node] = external(node)
 	}
 
-	for from, weight := range q.network[node] {
-		prob := float64(weight) / float64(requests[from])
+	for i := 0; i < maxFlowIterations; i++ {
+		settled := true
+		for node := range q.network {
+			flow := external(node)
+			for from, weight := range q.network[node] {
+				if requests[from] > 0 {
+					flow += float64(weight) / float64(requests[from]) * flows[from]
+				}
+			}
 
-		if _, ok := rates[from]; !ok {
-			rates[from] = q.incomingRate(from, requests, rates)
+			if flow != flows[node] && !(math.Abs(flow-flows[node]) <= 1e-12*math.Max(1.0, flows[node])) {
+				settled = false
+			}
+			flows[node] = flow
+		}
+		if settled {
+			break
 		}
-
-		rate += prob * rates[from]
 	}
 
-	rates[node] = rate
+	return flows
+}
 
-	return rate
+// propagate spreads the external rates of the nodes, as given by external,
+// through the network.
+func (q *QueueNetwork) propagate(requests map[string]uint, external func(*RateEstimator) float64) map[string]float64 {
+	return q.flows(requests, func(node string) float64 {
+		if estimator, ok := q.incomingRates[node]; ok {
+			return external(estimator)
+		}
+
+		return 0.0
+	})
 }
 
 func (q *QueueNetwork) UpdateEstimates(interval time.Duration) {
@@ -50,12 +81,7 @@ func (q *QueueNetwork) UpdateEstimates(interval time.Duration) {
 }
 
 func (q *QueueNetwork) IncomingRates() map[string]float64 {
-	incomingRequests := q.incomingRequests()
-	incomingRates := make(map[string]float64, len(q.network))
-
-	for node := range q.network {
-		q.incomingRate(node, incomingRequests, incomingRates)
-	}
-
-	return incomingRates
+	return q.propagate(q.incomingRequests(), func(r *RateEstimator) float64 {
+		return r.Estimate
+	})
 }
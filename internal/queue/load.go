@@ -0,0 +1,161 @@
+package queue
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// loadBins groups per-replica arrival rates in powers of two, from below
+	// 1 req/s up to 2^14 req/s and above.
+	loadBins = 16
+
+	// minLoadRequests is how many requests a bin must hold before its mean
+	// duration is trusted.
+	minLoadRequests = 10
+)
+
+// loadBin accumulates the requests served during the intervals in which the
+// per-replica arrival rate fell in the same bin.
+type loadBin struct {
+	durationSum  uint64
+	intervals    uint64
+	rateSum      float64
+	requestCount uint64
+}
+
+type loadMark struct {
+	durationSum  uint64
+	requestCount uint64
+}
+
+func binOf(rate float64) int {
+	if rate < 1.0 {
+		return 0
+	}
+
+	return min(loadBins-1, 1+int(math.Floor(math.Log2(rate))))
+}
+
+func (q *QueueMetric) addLoad(rate float64, durationSum uint64, requestCount uint64) {
+	bin := &q.load[binOf(rate)]
+	bin.durationSum += durationSum
+	bin.intervals += 1
+	bin.rateSum += rate
+	bin.requestCount += requestCount
+}
+
+// ServiceTime returns the mean duration in seconds of the requests served
+// when every replica receives rate requests per second. It interpolates
+// between the mean rate and duration of the bins holding enough requests,
+// extending the last trend beyond the heaviest load observed.
+func (q *QueueMetric) ServiceTime(rate float64) (float64, bool) {
+	var rates, durations []float64
+	for _, bin := range q.load {
+		if bin.requestCount < minLoadRequests {
+			continue
+		}
+		rates = append(rates, bin.rateSum/float64(bin.intervals))
+		durations = append(durations, float64(bin.durationSum)/1e9/float64(bin.requestCount))
+	}
+
+	if len(rates) == 0 {
+		return 0.0, false
+	}
+	if len(rates) == 1 || rate <= rates[0] {
+		return durations[0], true
+	}
+
+	last := len(rates) - 1
+	i := 1
+	for i < last && rate > rates[i] {
+		i++
+	}
+	if rates[i] == rates[i-1] {
+		return durations[i], true
+	}
+
+	slope := (durations[i] - durations[i-1]) / (rates[i] - rates[i-1])
+	if rate > rates[last] && slope < 0 {
+		return durations[last], true
+	}
+
+	return durations[i-1] + slope*(rate-rates[i-1]), true
+}
+
+// slowdown is how much longer requests take at the given per-replica rate
+// than at the lightest load observed, never less than 1.
+func (q *QueueMetric) slowdown(rate float64) float64 {
+	lightest, ok := q.ServiceTime(0.0)
+	if !ok || lightest == 0.0 {
+		return 1.0
+	}
+
+	duration, _ := q.ServiceTime(rate)
+
+	return math.Max(1.0, duration/lightest)
+}
+
+// RecordLoad closes a measurement interval of the given length. The requests
+// every node served during the interval are binned by the arrival rate each
+// of its replicas received, counting the pods seen as replicas. Nodes whose
+// spans do not name their pod are assumed to run a single replica.
+func (q *QueueNetwork) RecordLoad(elapsed time.Duration) {
+	if q.marks == nil {
+		q.marks = map[string]loadMark{}
+	}
+
+	for node, metric := range q.NodeMetrics {
+		mark, ok := q.marks[node]
+		q.marks[node] = loadMark{durationSum: metric.durationSum, requestCount: metric.requestCount}
+		if !ok || metric.requestCount <= mark.requestCount || elapsed <= 0 {
+			continue
+		}
+
+		replicas := max(1, len(q.pods[node]))
+		count := metric.requestCount - mark.requestCount
+		rate := float64(count) / elapsed.Seconds() / float64(replicas)
+		metric.addLoad(rate, metric.durationSum-mark.durationSum, count)
+	}
+
+	q.pods = map[string]map[string]struct{}{}
+}
+
+func (q *QueueNetwork) addPod(node string, pod string) {
+	if q.pods == nil {
+		q.pods = map[string]map[string]struct{}{}
+	}
+	if _, ok := q.pods[node]; !ok {
+		q.pods[node] = map[string]struct{}{}
+	}
+
+	q.pods[node][pod] = struct{}{}
+}
+
+// ServiceRateAt is the rate at which a replica of node serves a single
+// request when every replica receives rate requests per second. Without
+// enough intervals measured, it is the same at every load.
+func (q *QueueNetwork) ServiceRateAt(node string, rate float64) float64 {
+	metric, ok := q.NodeMetrics[node]
+	if !ok {
+		return 0.0
+	}
+
+	if levels, ok := q.concurrency[node]; ok {
+		if _, base, ok := levels.estimate(); ok {
+			return 1.0 / base / metric.slowdown(rate)
+		}
+	}
+
+	if duration, ok := metric.ServiceTime(rate); ok && duration > 0.0 {
+		return 1.0 / duration
+	}
+
+	return metric.ServiceRate()
+}
+
+// ReplicaRateAt is the throughput of a replica of node when every replica
+// receives rate requests per second.
+func (q *QueueNetwork) ReplicaRateAt(node string, rate float64) float64 {
+	return q.Concurrency(node) * q.ServiceRateAt(node, rate)
+}
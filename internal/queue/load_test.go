@@ -0,0 +1,77 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestRecordLoad(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	serve := func(count int, duration uint64) {
+		for i := 0; i < count; i++ {
+			network.AddExternalRequest(&receiver.Span{
+				Duration:    duration,
+				Pod:         fmt.Sprintf("frontend-%d", i%2),
+				ServiceName: "frontend",
+			})
+		}
+		network.RecordLoad(time.Second)
+	}
+
+	// the first interval only sets the baseline
+	serve(1000, 1e6)
+	_, ok := network.NodeMetrics["frontend"].ServiceTime(0.0)
+	assert.Assert(t, !ok)
+	assert.Assert(t, compareFloats(network.ServiceRateAt("frontend", 100.0), 1000.0, 10e-9))
+
+	// 10 and 100 req/s for each of the two pods
+	serve(20, 10e6)
+	serve(200, 20e6)
+
+	metric := network.NodeMetrics["frontend"]
+	for _, test := range []struct {
+		rate     float64
+		expected float64
+	}{
+		{rate: 0.0, expected: 0.01},
+		{rate: 10.0, expected: 0.01},
+		{rate: 55.0, expected: 0.015},
+		{rate: 100.0, expected: 0.02},
+		{rate: 190.0, expected: 0.03},
+	} {
+		duration, ok := metric.ServiceTime(test.rate)
+		assert.Assert(t, ok)
+		assert.Assert(t, compareFloats(duration, test.expected, 10e-9), "rate %f: %f", test.rate, duration)
+	}
+
+	assert.Assert(t, compareFloats(network.ServiceRateAt("frontend", 55.0), 1/0.015, 10e-9))
+	assert.Assert(t, compareFloats(network.ReplicaRateAt("frontend", 55.0), 1/0.015, 10e-9))
+
+	clone := network.Clone()
+	assert.Assert(t, compareFloats(clone.ServiceRateAt("frontend", 55.0), 1/0.015, 10e-9))
+
+	data, err := network.MarshalJSON()
+	assert.NilError(t, err)
+	restored := NewQueueNetwork()
+	assert.NilError(t, restored.UnmarshalJSON(data))
+	assert.Assert(t, compareFloats(restored.ServiceRateAt("frontend", 55.0), 1/0.015, 10e-9))
+}
+
+func TestLoadDecreasingTrend(t *testing.T) {
+	t.Parallel()
+
+	metric := &QueueMetric{}
+	metric.addLoad(10.0, 10*20e6, 10)
+	metric.addLoad(100.0, 10*10e6, 10)
+
+	duration, ok := metric.ServiceTime(1000.0)
+	assert.Assert(t, ok)
+	assert.Assert(t, compareFloats(duration, 0.01, 10e-9))
+	assert.Assert(t, compareFloats(metric.slowdown(1000.0), 1.0, 10e-9))
+}
@@ -0,0 +1,133 @@
+package queue
+
+// Merge adds the requests observed by delta to the network. Windowed counts
+// of delta are only kept if they belong to windows that are still open. The
+// rate estimates of delta are added to the ones of the network, so that the
+// models of instances observing different requests can be combined.
+func (q *QueueNetwork) Merge(delta *QueueNetwork) {
+	for node, metric := range delta.NodeMetrics {
+		q.AddNode(node)
+		q.NodeMetrics[node].durationSum += metric.durationSum
+		q.NodeMetrics[node].requestCount += metric.requestCount
+		for i, bin := range metric.load {
+			target := &q.NodeMetrics[node].load[i]
+			target.durationSum += bin.durationSum
+			target.intervals += bin.intervals
+			target.rateSum += bin.rateSum
+			target.requestCount += bin.requestCount
+		}
+	}
+
+	for node, histogram := range delta.histograms {
+		q.histogram(node).Merge(histogram)
+	}
+
+	for node, pods := range delta.pods {
+		for pod := range pods {
+			q.addPod(node, pod)
+		}
+	}
+
+	for node, callers := range delta.network {
+		for caller, weight := range callers {
+			q.AddNode(caller)
+			q.network[node][caller] += weight
+		}
+	}
+
+	for node, levels := range delta.concurrency {
+		q.nodeConcurrency(node).merge(levels)
+	}
+
+	for node, observed := range delta.observed {
+		if current, ok := q.observed[node]; !ok || observed.at.After(current.at) {
+			q.observed[node] = observed
+		}
+	}
+
+	for node, estimator := range delta.incomingRates {
+		target := q.estimator(node)
+		target.latestRequests += estimator.latestRequests
+		target.totalRequests += estimator.totalRequests
+
+		// rates observed by other instances add up, and so do their
+		// variances λ·weightSquares
+		if estimator.Estimate > 0.0 && target.Estimate > 0.0 {
+			target.weightSquares = (target.Estimate*target.weightSquares + estimator.Estimate*estimator.weightSquares) /
+				(target.Estimate + estimator.Estimate)
+			target.weightSum = (target.Estimate*target.weightSum + estimator.Estimate*estimator.weightSum) /
+				(target.Estimate + estimator.Estimate)
+			target.Estimate += estimator.Estimate
+		} else if estimator.Estimate > 0.0 || target.weightSquares == 0.0 {
+			target.Estimate += estimator.Estimate
+			target.weightSquares = estimator.weightSquares
+			target.weightSum = estimator.weightSum
+		}
+	}
+
+	if q.windows == nil || delta.windows == nil {
+		return
+	}
+
+	q.windows.late += delta.windows.late
+	for node, counts := range delta.windows.counts {
+		for index, count := range counts {
+			if index < q.windows.closed {
+				q.windows.late += count
+				continue
+			}
+
+			if _, ok := q.windows.counts[node]; !ok {
+				q.windows.counts[node] = map[int64]uint{}
+			}
+			q.windows.counts[node][index] += count
+		}
+	}
+}
+
+func (q *QueueNetwork) Clone() *QueueNetwork {
+	clone := NewQueueNetwork()
+	clone.Merge(q)
+
+	if q.windows != nil {
+		clone.UseEventTime(q.windows.start, q.windows.size)
+		clone.windows.closed = q.windows.closed
+		clone.windows.late = q.windows.late
+		for node, counts := range q.windows.counts {
+			clone.windows.counts[node] = make(map[int64]uint, len(counts))
+			for index, count := range counts {
+				clone.windows.counts[node][index] = count
+			}
+		}
+	}
+
+	return clone
+}
+
+// Restrict forgets everything observed at the nodes allows rejects. The calls
+// they made to the other nodes are kept.
+func (q *QueueNetwork) Restrict(allows func(node string) bool) {
+	for node := range q.network {
+		if allows(node) {
+			continue
+		}
+
+		delete(q.NodeMetrics, node)
+		delete(q.concurrency, node)
+		delete(q.histograms, node)
+		delete(q.incomingRates, node)
+		delete(q.marks, node)
+		delete(q.network, node)
+		delete(q.observed, node)
+		delete(q.pods, node)
+		if q.windows != nil {
+			delete(q.windows.counts, node)
+		}
+	}
+
+	for _, callers := range q.network {
+		for caller := range callers {
+			q.AddNode(caller)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+
+	requests := []*receiver.Span{
+		{Duration: 100, ServiceName: "node1", SpanId: "span1"},
+		{Duration: 50, Parent: "span1", ServiceName: "node2", SpanId: "span2"},
+		{Duration: 100, ServiceName: "node1", SpanId: "span3"},
+		{Duration: 70, Parent: "span3", ServiceName: "node3", SpanId: "span4"},
+	}
+
+	expected := NewQueueNetwork()
+	first := NewQueueNetwork()
+	second := NewQueueNetwork()
+	for i, delta := range []*QueueNetwork{first, second} {
+		parent, child := requests[2*i], requests[2*i+1]
+
+		expected.AddExternalRequest(parent)
+		expected.AddInternalRequest(parent, child)
+		delta.AddExternalRequest(parent)
+		delta.AddInternalRequest(parent, child)
+	}
+
+	merged := NewQueueNetwork()
+	merged.Merge(first)
+	merged.Merge(second)
+	assert.Assert(t, queueNetworkComparer(merged, expected))
+
+	merged.UpdateEstimates(time.Second)
+	expected.UpdateEstimates(time.Second)
+	assert.Assert(t, queueNetworkComparer(merged, expected))
+}
+
+func TestMergeEventTime(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+	request := func(at time.Duration) *receiver.Span {
+		return &receiver.Span{
+			Duration:    1000,
+			ServiceName: "node1",
+			StartTime:   uint64(start.Add(at).UnixNano()),
+		}
+	}
+
+	network := NewQueueNetwork()
+	network.UseEventTime(start, time.Second)
+	network.CloseWindows(start.Add(time.Second))
+
+	delta := NewQueueNetwork()
+	delta.UseEventTime(start, time.Second)
+	delta.AddExternalRequest(request(500 * time.Millisecond))
+	delta.AddExternalRequest(request(1500 * time.Millisecond))
+	delta.AddExternalRequest(request(1600 * time.Millisecond))
+	delta.AddExternalRequest(request(-time.Second))
+
+	network.Merge(delta)
+	assert.Equal(t, uint(2), network.LateRequests())
+
+	network.CloseWindows(start.Add(2 * time.Second))
+	assert.Assert(t, compareEstimates(map[string]float64{"node1": 1.6}, network))
+}
+
+func TestClone(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	network.UseEventTime(time.Unix(0, 0), time.Second)
+	network.AddExternalRequest(&receiver.Span{Duration: 100, ServiceName: "node1", SpanId: "span1"})
+	network.AddInternalRequest(
+		&receiver.Span{ServiceName: "node1"},
+		&receiver.Span{Duration: 50, Parent: "span1", ServiceName: "node2"})
+	network.CloseWindows(time.Unix(1, 0))
+
+	clone := network.Clone()
+	assert.Assert(t, queueNetworkComparer(clone, network))
+	assert.Equal(t, network.ToDOT(), clone.ToDOT())
+
+	network.AddExternalRequest(&receiver.Span{Duration: 100, ServiceName: "node3"})
+	assert.Equal(t, 2, len(clone.NodeMetrics))
+}
+
+func TestMergeEstimates(t *testing.T) {
+	t.Parallel()
+
+	publish := func(requests int) *QueueNetwork {
+		network := NewQueueNetwork()
+		for i := 0; i < requests; i++ {
+			network.AddExternalRequest(&receiver.Span{Duration: 100, ServiceName: "node1"})
+		}
+		network.UpdateEstimates(time.Second)
+
+		return network
+	}
+
+	first, second := publish(10), publish(30)
+	merged := first.Clone()
+	merged.Merge(second)
+
+	estimator := merged.incomingRates["node1"]
+	assert.Assert(t, compareFloats(estimator.Estimate, 0.8*40, 10e-9))
+	assert.Equal(t, estimator.totalRequests, uint(40))
+	assert.Assert(t, compareFloats(estimator.weightSquares, first.incomingRates["node1"].weightSquares, 10e-9))
+}
+
+func TestRestrict(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	network.AddExternalRequest(&receiver.Span{Duration: 100, ServiceName: "node1", SpanId: "span1"})
+	network.AddInternalRequest(
+		&receiver.Span{ServiceName: "node1"},
+		&receiver.Span{Duration: 50, Parent: "span1", ServiceName: "node2"})
+	network.UpdateEstimates(time.Second)
+
+	network.Restrict(func(node string) bool { return node == "node2" })
+
+	assert.Equal(t, network.NodeMetrics["node1"].requestCount, uint64(0))
+	assert.Equal(t, network.NodeMetrics["node2"].requestCount, uint64(1))
+	assert.Equal(t, len(network.ExternalRates()), 0)
+	assert.Equal(t, network.network["node2"]["node1"], uint(1))
+	assert.Assert(t, network.Histogram("node1") == nil)
+}
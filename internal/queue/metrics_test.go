@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestAddMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := receiver.NewMetrics()
+	metrics.Services["frontend"] = &receiver.ServiceMetrics{Count: 10, DurationSum: 5000}
+	metrics.Services["backend"] = &receiver.ServiceMetrics{Count: 25, DurationSum: 2500}
+	metrics.Calls[receiver.Edge{Client: "frontend", Server: "backend"}] = 20
+	metrics.Calls[receiver.Edge{Client: "backend", Server: "database"}] = 40
+
+	network := NewQueueNetwork()
+	network.AddMetrics(metrics)
+
+	expected := &QueueNetwork{
+		NodeMetrics: map[string]*QueueMetric{
+			"frontend": {durationSum: 5000, requestCount: 10},
+			"backend":  {durationSum: 2500, requestCount: 25},
+			"database": {},
+		},
+		incomingRates: map[string]*RateEstimator{
+			"frontend": {latestRequests: 10, totalRequests: 10},
+			"backend":  {latestRequests: 5, totalRequests: 5},
+		},
+		network: map[string]map[string]uint{
+			"frontend": {},
+			"backend":  {"frontend": 20},
+			"database": {"backend": 40},
+		},
+	}
+	assert.Assert(t, queueNetworkComparer(network, expected))
+
+	network.UpdateEstimates(time.Second)
+	rates := network.IncomingRates()
+	assert.Equal(t, rates["frontend"], 8.0)
+	assert.Equal(t, rates["backend"], 0.8*5+20.0/10*8)
+}
+
+func TestAddMetricsEventTime(t *testing.T) {
+	t.Parallel()
+
+	metrics := receiver.NewMetrics()
+	metrics.Services["frontend"] = &receiver.ServiceMetrics{Count: 4, DurationSum: 400}
+
+	start := time.Unix(0, 0)
+	network := NewQueueNetwork()
+	network.UseEventTime(start, time.Second)
+	network.CloseWindows(start.Add(2 * time.Second))
+	network.AddMetrics(metrics)
+	network.CloseWindows(start.Add(3 * time.Second))
+
+	assert.Equal(t, network.ExternalRates()["frontend"], 0.8*4)
+}
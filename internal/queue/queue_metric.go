@@ -2,6 +2,7 @@ package queue
 
 type QueueMetric struct {
 	durationSum  uint64
+	load         [loadBins]loadBin
 	requestCount uint64
 }
 
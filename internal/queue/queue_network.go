@@ -1,18 +1,33 @@
 package queue
 
-import "github.com/pako-23/queue-scaler/internal/receiver"
+import (
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+)
 
 type QueueNetwork struct {
 	NodeMetrics   map[string]*QueueMetric
+	concurrency   map[string]*concurrency
+	histograms    map[string]*Histogram
 	incomingRates map[string]*RateEstimator
+	marks         map[string]loadMark
 	network       map[string]map[string]uint
+	observed      map[string]observation
+	pods          map[string]map[string]struct{}
+	windows       *eventWindows
 }
 
 func NewQueueNetwork() *QueueNetwork {
 	return &QueueNetwork{
 		NodeMetrics:   map[string]*QueueMetric{},
+		concurrency:   map[string]*concurrency{},
+		histograms:    map[string]*Histogram{},
 		incomingRates: map[string]*RateEstimator{},
+		marks:         map[string]loadMark{},
 		network:       map[string]map[string]uint{},
+		observed:      map[string]observation{},
+		pods:          map[string]map[string]struct{}{},
 	}
 }
 
@@ -30,22 +45,73 @@ func (q *QueueNetwork) AddExternalRequest(request *receiver.Span) {
 	q.AddNode(request.ServiceName)
 	q.NodeMetrics[request.ServiceName].durationSum += request.Duration
 	q.NodeMetrics[request.ServiceName].requestCount += 1
+	q.histogram(request.ServiceName).Add(request.Duration)
+	q.estimator(request.ServiceName).totalRequests += 1
+	if request.Pod != "" {
+		q.addPod(request.ServiceName, request.Pod)
+		q.nodeConcurrency(request.ServiceName).add(request.Pod, request.StartTime, request.Duration)
+	}
+
+	if q.windows != nil {
+		q.windows.add(request)
+	} else {
+		q.incomingRates[request.ServiceName].latestRequests += 1
+	}
+}
 
-	if _, ok := q.incomingRates[request.ServiceName]; !ok {
-		q.incomingRates[request.ServiceName] = &RateEstimator{
+func (q *QueueNetwork) estimator(node string) *RateEstimator {
+	if _, ok := q.incomingRates[node]; !ok {
+		q.incomingRates[node] = &RateEstimator{
 			Estimate:       0.0,
 			latestRequests: 0,
 			totalRequests:  0,
 		}
 	}
-	q.incomingRates[request.ServiceName].latestRequests += 1
-	q.incomingRates[request.ServiceName].totalRequests += 1
+
+	return q.incomingRates[node]
+}
+
+// AddMetrics adds requests known only through aggregated metrics. The
+// requests a service served and were not calls from another service are
+// counted as external. Under event time, they belong to the oldest open
+// window.
+func (q *QueueNetwork) AddMetrics(metrics *receiver.Metrics) {
+	calls := map[string]uint64{}
+	for edge, count := range metrics.Calls {
+		q.AddNode(edge.Client)
+		q.AddNode(edge.Server)
+		q.network[edge.Server][edge.Client] += uint(count)
+		calls[edge.Server] += count
+	}
+
+	for service, served := range metrics.Services {
+		q.AddNode(service)
+		q.NodeMetrics[service].durationSum += served.DurationSum
+		q.NodeMetrics[service].requestCount += served.Count
+
+		if served.Count <= calls[service] {
+			continue
+		}
+
+		external := uint(served.Count - calls[service])
+		q.estimator(service).totalRequests += external
+		if q.windows != nil {
+			q.windows.addCount(service, q.windows.closed, external)
+		} else {
+			q.incomingRates[service].latestRequests += external
+		}
+	}
 }
 
 func (q *QueueNetwork) AddInternalRequest(parent *receiver.Span, request *receiver.Span) {
 	q.AddNode(request.ServiceName)
 	q.NodeMetrics[request.ServiceName].durationSum += request.Duration
 	q.NodeMetrics[request.ServiceName].requestCount += 1
+	q.histogram(request.ServiceName).Add(request.Duration)
+	if request.Pod != "" {
+		q.addPod(request.ServiceName, request.Pod)
+		q.nodeConcurrency(request.ServiceName).add(request.Pod, request.StartTime, request.Duration)
+	}
 
 	if parent.ServiceName == request.ServiceName {
 		return
@@ -59,3 +125,69 @@ func (q *QueueNetwork) AddInternalRequest(parent *receiver.Span, request *receiv
 		q.network[request.ServiceName][parent.ServiceName] = 1
 	}
 }
+
+// observation is a queue length measured outside of the traces.
+type observation struct {
+	at     time.Time
+	length float64
+}
+
+// ObserveQueueLength records the number of requests a node was serving or
+// queueing at a given time, as measured outside of the traces. It replaces
+// the previous observation.
+func (q *QueueNetwork) ObserveQueueLength(node string, length float64, at time.Time) {
+	q.AddNode(node)
+	q.observed[node] = observation{at: at, length: length}
+}
+
+// ObserveQueueLengths replaces every observed queue length by the ones of a
+// new measurement. Nodes missing from it are no longer observed.
+func (q *QueueNetwork) ObserveQueueLengths(lengths map[string]float64, at time.Time) {
+	clear(q.observed)
+	for node, length := range lengths {
+		q.ObserveQueueLength(node, length, at)
+	}
+}
+
+// ExpireQueueLengths forgets the queue lengths observed before a given time.
+func (q *QueueNetwork) ExpireQueueLengths(before time.Time) {
+	for node, observed := range q.observed {
+		if observed.at.Before(before) {
+			delete(q.observed, node)
+		}
+	}
+}
+
+func (q *QueueNetwork) ObservedQueueLengths() map[string]float64 {
+	lengths := make(map[string]float64, len(q.observed))
+	for node, observed := range q.observed {
+		lengths[node] = observed.length
+	}
+
+	return lengths
+}
+
+func (q *QueueNetwork) ExternalRates() map[string]float64 {
+	rates := make(map[string]float64, len(q.incomingRates))
+	for node, estimator := range q.incomingRates {
+		rates[node] = estimator.Estimate
+	}
+
+	return rates
+}
+
+func (q *QueueNetwork) RoutingProbabilities() map[string]map[string]float64 {
+	incomingRequests := q.incomingRequests()
+	probabilities := make(map[string]map[string]float64, len(q.network))
+
+	for to, incoming := range q.network {
+		for from, weight := range incoming {
+			if _, ok := probabilities[from]; !ok {
+				probabilities[from] = map[string]float64{}
+			}
+			probabilities[from][to] = float64(weight) / float64(incomingRequests[from])
+		}
+	}
+
+	return probabilities
+}
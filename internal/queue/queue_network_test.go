@@ -484,3 +484,35 @@ func TestAddInternalRequest(t *testing.T) {
 		assert.Assert(t, queueNetworkComparer(value, &test.expected))
 	}
 }
+
+func TestRoutingProbabilities(t *testing.T) {
+	t.Parallel()
+
+	network := QueueNetwork{
+		NodeMetrics: map[string]*QueueMetric{
+			"node1": {durationSum: 100000000, requestCount: 100},
+			"node2": {durationSum: 3000000000, requestCount: 30},
+			"node3": {durationSum: 1000000000, requestCount: 70},
+			"node4": {durationSum: 2600000000, requestCount: 100},
+		},
+		incomingRates: map[string]*RateEstimator{
+			"node1": {
+				Estimate:      100.0,
+				totalRequests: 100,
+			},
+		},
+		network: map[string]map[string]uint{
+			"node1": {},
+			"node2": {"node1": 30},
+			"node3": {"node1": 70},
+			"node4": {"node2": 30, "node3": 70},
+		},
+	}
+
+	assert.DeepEqual(t, map[string]float64{"node1": 100.0}, network.ExternalRates())
+	assert.DeepEqual(t, map[string]map[string]float64{
+		"node1": {"node2": 0.3, "node3": 0.7},
+		"node2": {"node4": 1.0},
+		"node3": {"node4": 1.0},
+	}, network.RoutingProbabilities())
+}
@@ -8,9 +8,17 @@ type RateEstimator struct {
 	Estimate       float64
 	latestRequests uint
 	totalRequests  uint
+	// weightSquares sums the squared weight of every interval in the
+	// estimate divided by its length, so that a Poisson rate λ gives the
+	// estimate a variance of λ·weightSquares.
+	weightSquares float64
+	// weightSum sums the weight of every interval in the estimate.
+	weightSum float64
 }
 
 func (r *RateEstimator) Update(interval time.Duration) {
 	r.Estimate = (1-alpha)*r.Estimate + alpha*(float64(r.latestRequests)/interval.Seconds())
+	r.weightSquares = (1-alpha)*(1-alpha)*r.weightSquares + alpha*alpha/interval.Seconds()
+	r.weightSum = (1-alpha)*r.weightSum + alpha
 	r.latestRequests = 0
 }
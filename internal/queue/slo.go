@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minSLORequests is how many durations an entry point must have before the
+// shape of its latency distribution is taken from them.
+const minSLORequests = 10
+
+// SLO bounds the end-to-end latency of the requests entering at a node: its
+// mean when Quantile is 0, the given quantile otherwise.
+type SLO struct {
+	Quantile float64
+	Target   time.Duration
+}
+
+// ParseSLOs parses comma-separated entry=objective:target pairs, such as
+// "checkout=p95:300ms,search=mean:100ms".
+func ParseSLOs(value string) (map[string]SLO, error) {
+	slos := map[string]SLO{}
+	if strings.TrimSpace(value) == "" {
+		return slos, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		node, objective, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || node == "" {
+			return nil, fmt.Errorf("invalid SLO %q, expected entry=objective:target", entry)
+		}
+
+		statistic, target, ok := strings.Cut(objective, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid SLO %q, expected entry=objective:target", entry)
+		}
+
+		slo := SLO{}
+		if statistic != "mean" {
+			percentile, err := strconv.ParseFloat(strings.TrimPrefix(statistic, "p"), 64)
+			if err != nil || !strings.HasPrefix(statistic, "p") || percentile <= 0 || percentile >= 100 {
+				return nil, fmt.Errorf("invalid SLO %q: objective must be mean or a percentile such as p95", entry)
+			}
+			slo.Quantile = percentile / 100
+		}
+
+		duration, err := time.ParseDuration(target)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("invalid SLO %q: target must be a positive duration", entry)
+		}
+		slo.Target = duration
+
+		slos[node] = slo
+	}
+
+	return slos, nil
+}
+
+// meanTarget turns the SLO of an entry point into a bound on its mean
+// end-to-end latency, in seconds. Quantiles are assumed to keep their ratio
+// to the mean observed at the entry point, whose requests span the whole
+// network, or the one of an exponential distribution until enough were seen.
+func (q *QueueNetwork) meanTarget(entry string, slo SLO) float64 {
+	target := slo.Target.Seconds()
+	if slo.Quantile == 0.0 {
+		return target
+	}
+
+	ratio := -math.Log(1 - slo.Quantile)
+	if histogram, ok := q.histograms[entry]; ok && histogram.Count() >= minSLORequests && histogram.Mean() > 0.0 {
+		ratio = histogram.Quantile(slo.Quantile) / histogram.Mean()
+	}
+
+	return target / math.Max(ratio, 1e-9)
+}
+
+// LatencyBudgets bounds the mean time in seconds the requests of every node
+// visited by entry points with an SLO may wait before being served, so that
+// meeting them all meets the SLOs. Since the time a node takes to serve a
+// request includes the calls it makes, each node only adds the part of its
+// service time not spent in its callees to the time requests spend being
+// served. The slack an SLO leaves above that time is shared among the nodes
+// in proportion to their service times. Nodes visited from several entry
+// points get the tightest bound. SLOs of nodes without external requests are
+// ignored, and the entry points whose SLO is below the service time alone are
+// returned as unattainable without bounding their nodes.
+func (q *QueueNetwork) LatencyBudgets(slos map[string]SLO, serviceRate func(node string) float64) (map[string]float64, []string) {
+	budgets := map[string]float64{}
+	unattainable := []string{}
+	requests := q.incomingRequests()
+
+	for entry, slo := range slos {
+		if _, ok := q.incomingRates[entry]; !ok {
+			continue
+		}
+
+		ratios := q.VisitRatios(entry)
+		serviceTimes := make(map[string]float64, len(ratios))
+		for node, ratio := range ratios {
+			if ratio == 0.0 {
+				continue
+			}
+			if rate := serviceRate(node); rate > 0.0 {
+				serviceTimes[node] = 1.0 / rate
+			}
+		}
+
+		work, total := 0.0, 0.0
+		for node, serviceTime := range serviceTimes {
+			work += ratios[node] * q.selfTime(node, serviceTime, serviceTimes, requests)
+			total += ratios[node] * serviceTime
+		}
+		if work == 0.0 {
+			continue
+		}
+
+		slack := q.meanTarget(entry, slo) - work
+		if slack <= 0.0 {
+			unattainable = append(unattainable, entry)
+			continue
+		}
+
+		for node, serviceTime := range serviceTimes {
+			budget := serviceTime * slack / total
+			if current, ok := budgets[node]; !ok || budget < current {
+				budgets[node] = budget
+			}
+		}
+	}
+	sort.Strings(unattainable)
+
+	return budgets, unattainable
+}
+
+// selfTime is the part of the service time of node not spent waiting for the
+// calls it makes, given the service times of its callees.
+func (q *QueueNetwork) selfTime(node string, serviceTime float64, serviceTimes map[string]float64, requests map[string]uint) float64 {
+	if requests[node] == 0 {
+		return serviceTime
+	}
+
+	for callee, callers := range q.network {
+		if weight, ok := callers[node]; ok {
+			serviceTime -= float64(weight) / float64(requests[node]) * serviceTimes[callee]
+		}
+	}
+
+	return math.Max(serviceTime, 0.0)
+}
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseSLOs(t *testing.T) {
+	t.Parallel()
+
+	slos, err := ParseSLOs("checkout=p95:300ms, search=mean:100ms,home=p99:1s")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, slos, map[string]SLO{
+		"checkout": {Quantile: 0.95, Target: 300 * time.Millisecond},
+		"home":     {Quantile: 0.99, Target: time.Second},
+		"search":   {Quantile: 0.0, Target: 100 * time.Millisecond},
+	})
+
+	slos, err = ParseSLOs("")
+	assert.NilError(t, err)
+	assert.Equal(t, len(slos), 0)
+
+	for _, value := range []string{"checkout", "checkout=300ms", "=p95:300ms", "checkout=p100:1s", "checkout=median:1s", "checkout=p95:fast", "checkout=p95:-1s"} {
+		_, err := ParseSLOs(value)
+		assert.Assert(t, err != nil, value)
+	}
+}
+
+func TestLatencyBudgets(t *testing.T) {
+	t.Parallel()
+
+	// every request to frontend also visits backend, frontend takes 20ms
+	// including the 10ms of backend
+	network := NewQueueNetwork()
+	assert.NilError(t, json.Unmarshal([]byte(`{
+		"admin": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 80, "totalRequests": 100},
+		"backend": {"durationSum": 1000000000, "requestCount": 100, "callers": {"frontend": 100}},
+		"frontend": {"durationSum": 2000000000, "requestCount": 100, "incomingRate": 80, "totalRequests": 100},
+		"worker": {"durationSum": 1000000000, "requestCount": 100}
+	}`), network))
+
+	for _, test := range []struct {
+		slos         map[string]SLO
+		expected     map[string]float64
+		unattainable []string
+	}{
+		// the 20ms of slack are shared by service time
+		{
+			slos:     map[string]SLO{"frontend": {Target: 40 * time.Millisecond}},
+			expected: map[string]float64{"backend": 0.02 / 3, "frontend": 0.04 / 3},
+		},
+		// the time of backend is only counted once
+		{
+			slos:     map[string]SLO{"frontend": {Target: 23 * time.Millisecond}},
+			expected: map[string]float64{"backend": 0.001, "frontend": 0.002},
+		},
+		// quantiles of exponential end-to-end latencies
+		{
+			slos:     map[string]SLO{"admin": {Quantile: 0.95, Target: 60 * time.Millisecond}},
+			expected: map[string]float64{"admin": 0.06/-math.Log(0.05) - 0.01},
+		},
+		// unreachable objectives bound nothing
+		{
+			slos:         map[string]SLO{"admin": {Target: 10 * time.Millisecond}, "frontend": {Target: 5 * time.Millisecond}},
+			expected:     map[string]float64{},
+			unattainable: []string{"admin", "frontend"},
+		},
+		// backend is not an entry point
+		{
+			slos:     map[string]SLO{"backend": {Target: time.Millisecond}, "frontend": {Target: 50 * time.Millisecond}},
+			expected: map[string]float64{"backend": 0.01, "frontend": 0.02},
+		},
+	} {
+		budgets, unattainable := network.LatencyBudgets(test.slos, network.ServiceRate)
+		assert.DeepEqual(t, unattainable, append([]string{}, test.unattainable...))
+		assert.Equal(t, len(budgets), len(test.expected))
+		for node, expected := range test.expected {
+			assert.Assert(t, compareFloats(budgets[node], expected, 10e-9), "%s: %f", node, budgets[node])
+		}
+	}
+}
+
+func TestLatencyBudgetsObservedQuantile(t *testing.T) {
+	t.Parallel()
+
+	network := NewQueueNetwork()
+	for i := 0; i < 100; i++ {
+		duration := uint64(10e6)
+		if i%10 == 0 {
+			duration = 100e6
+		}
+		network.AddExternalRequest(&receiver.Span{Duration: duration, ServiceName: "frontend"})
+	}
+
+	histogram := network.Histogram("frontend")
+	expected := 0.2*histogram.Mean()/histogram.Quantile(0.95) - histogram.Mean()
+	budgets, _ := network.LatencyBudgets(map[string]SLO{"frontend": {Quantile: 0.95, Target: 200 * time.Millisecond}}, network.ServiceRate)
+	assert.Assert(t, compareFloats(budgets["frontend"], expected, 10e-9), "%f", budgets["frontend"])
+}
@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type levelSnapshot struct {
+	DurationSum  uint64 `json:"durationSum"`
+	RequestCount uint64 `json:"requestCount"`
+}
+
+type histogramSnapshot struct {
+	Buckets    map[int]uint64 `json:"buckets"`
+	Count      uint64         `json:"count"`
+	Sum        float64        `json:"sum"`
+	SumSquares float64        `json:"sumSquares"`
+	Zeros      uint64         `json:"zeros,omitempty"`
+}
+
+type loadSnapshot struct {
+	DurationSum  uint64  `json:"durationSum"`
+	Intervals    uint64  `json:"intervals"`
+	RateSum      float64 `json:"rateSum"`
+	RequestCount uint64  `json:"requestCount"`
+}
+
+type nodeSnapshot struct {
+	Callers       map[string]uint        `json:"callers,omitempty"`
+	Concurrency   map[int]*levelSnapshot `json:"concurrency,omitempty"`
+	DurationSum   uint64                 `json:"durationSum"`
+	Estimate      *float64               `json:"incomingRate,omitempty"`
+	Histogram     *histogramSnapshot     `json:"histogram,omitempty"`
+	Load          map[int]*loadSnapshot  `json:"load,omitempty"`
+	Observed      *float64               `json:"observedQueueLength,omitempty"`
+	ObservedAt    *time.Time             `json:"observedAt,omitempty"`
+	RequestCount  uint64                 `json:"requestCount"`
+	TotalRequests uint                   `json:"totalRequests,omitempty"`
+	WeightSquares float64                `json:"incomingRateWeightSquares,omitempty"`
+	WeightSum     float64                `json:"incomingRateWeightSum,omitempty"`
+}
+
+func (q *QueueNetwork) MarshalJSON() ([]byte, error) {
+	nodes := make(map[string]*nodeSnapshot, len(q.network))
+
+	for node, callers := range q.network {
+		snapshot := &nodeSnapshot{
+			Callers:      callers,
+			DurationSum:  q.NodeMetrics[node].durationSum,
+			RequestCount: q.NodeMetrics[node].requestCount,
+		}
+
+		if levels, ok := q.concurrency[node]; ok && len(levels.levels) > 0 {
+			snapshot.Concurrency = make(map[int]*levelSnapshot, len(levels.levels))
+			for level, metric := range levels.levels {
+				snapshot.Concurrency[level] = &levelSnapshot{
+					DurationSum:  metric.durationSum,
+					RequestCount: metric.requestCount,
+				}
+			}
+		}
+
+		if histogram, ok := q.histograms[node]; ok && histogram.count > 0 {
+			snapshot.Histogram = &histogramSnapshot{
+				Buckets:    histogram.buckets,
+				Count:      histogram.count,
+				Sum:        histogram.sum,
+				SumSquares: histogram.sumSquares,
+				Zeros:      histogram.zeros,
+			}
+		}
+
+		for i, bin := range q.NodeMetrics[node].load {
+			if bin.intervals == 0 {
+				continue
+			}
+			if snapshot.Load == nil {
+				snapshot.Load = map[int]*loadSnapshot{}
+			}
+			snapshot.Load[i] = &loadSnapshot{
+				DurationSum:  bin.durationSum,
+				Intervals:    bin.intervals,
+				RateSum:      bin.rateSum,
+				RequestCount: bin.requestCount,
+			}
+		}
+
+		if observed, ok := q.observed[node]; ok {
+			snapshot.Observed = &observed.length
+			snapshot.ObservedAt = &observed.at
+		}
+
+		if estimator, ok := q.incomingRates[node]; ok {
+			estimate := estimator.Estimate
+			snapshot.Estimate = &estimate
+			snapshot.TotalRequests = estimator.totalRequests
+			snapshot.WeightSquares = estimator.weightSquares
+			snapshot.WeightSum = estimator.weightSum
+		}
+
+		nodes[node] = snapshot
+	}
+
+	return json.Marshal(nodes)
+}
+
+func (q *QueueNetwork) UnmarshalJSON(data []byte) error {
+	nodes := map[string]*nodeSnapshot{}
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		return err
+	}
+
+	*q = *NewQueueNetwork()
+	for node, snapshot := range nodes {
+		q.AddNode(node)
+		q.NodeMetrics[node].durationSum = snapshot.DurationSum
+		q.NodeMetrics[node].requestCount = snapshot.RequestCount
+
+		for caller, weight := range snapshot.Callers {
+			q.AddNode(caller)
+			q.network[node][caller] = weight
+		}
+
+		if snapshot.Histogram != nil {
+			q.histogram(node).Merge(&Histogram{
+				buckets:    snapshot.Histogram.Buckets,
+				count:      snapshot.Histogram.Count,
+				sum:        snapshot.Histogram.Sum,
+				sumSquares: snapshot.Histogram.SumSquares,
+				zeros:      snapshot.Histogram.Zeros,
+			})
+		}
+
+		for i, bin := range snapshot.Load {
+			if i < 0 || i >= loadBins {
+				return fmt.Errorf("load bin %d of node %s out of range", i, node)
+			}
+			q.NodeMetrics[node].load[i] = loadBin{
+				durationSum:  bin.DurationSum,
+				intervals:    bin.Intervals,
+				rateSum:      bin.RateSum,
+				requestCount: bin.RequestCount,
+			}
+		}
+
+		for level, metric := range snapshot.Concurrency {
+			q.nodeConcurrency(node).addLevel(level, metric.DurationSum, metric.RequestCount)
+		}
+
+		if snapshot.Observed != nil {
+			observed := observation{length: *snapshot.Observed}
+			if snapshot.ObservedAt != nil {
+				observed.at = *snapshot.ObservedAt
+			}
+			q.observed[node] = observed
+		}
+
+		if snapshot.Estimate != nil {
+			q.incomingRates[node] = &RateEstimator{
+				Estimate:       *snapshot.Estimate,
+				latestRequests: 0,
+				totalRequests:  snapshot.TotalRequests,
+				weightSquares:  snapshot.WeightSquares,
+				weightSum:      snapshot.WeightSum,
+			}
+		}
+	}
+
+	return nil
+}
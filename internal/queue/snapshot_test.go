@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	var tests = []*QueueNetwork{
+		NewQueueNetwork(),
+		{
+			NodeMetrics: map[string]*QueueMetric{
+				"node1": {durationSum: 100000000, requestCount: 100},
+				"node2": {durationSum: 3000000000, requestCount: 30},
+				"node3": {durationSum: 1000000000, requestCount: 70},
+				"node4": {durationSum: 2600000000, requestCount: 100},
+			},
+			incomingRates: map[string]*RateEstimator{
+				"node1": {
+					Estimate:      100.0,
+					totalRequests: 100,
+				},
+				"node3": {
+					Estimate:      0.0,
+					totalRequests: 3,
+				},
+			},
+			network: map[string]map[string]uint{
+				"node1": {},
+				"node2": {"node1": 30},
+				"node3": {"node1": 70},
+				"node4": {"node2": 30, "node3": 70},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		data, err := json.Marshal(test)
+		assert.NilError(t, err)
+
+		value := &QueueNetwork{}
+		assert.NilError(t, json.Unmarshal(data, value))
+		assert.Assert(t, queueNetworkComparer(value, test))
+	}
+}
+
+func TestSnapshotInvalid(t *testing.T) {
+	t.Parallel()
+
+	value := NewQueueNetwork()
+	assert.Assert(t, json.Unmarshal([]byte("[]"), value) != nil)
+}
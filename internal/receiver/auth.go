@@ -0,0 +1,162 @@
+package receiver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationHeader = "authorization"
+	apiKeyHeader        = "x-api-key"
+	bearerPrefix        = "bearer "
+	wildcard            = "*"
+)
+
+// Deployments reports whether the deployment of a service lives in a
+// namespace.
+type Deployments func(namespace string, service string) bool
+
+// Grant lists the namespaces and services a token may report spans for. A
+// service is allowed if it is listed, or if its deployment lives in one of
+// the namespaces. The namespace reported along with the spans is not trusted.
+type Grant struct {
+	Namespaces  []string `json:"namespaces,omitempty"`
+	Services    []string `json:"services,omitempty"`
+	deployments Deployments
+}
+
+func (g *Grant) allows(service string) bool {
+	if g == nil {
+		return true
+	}
+
+	if slices.Contains(g.Services, wildcard) || slices.Contains(g.Services, service) ||
+		slices.Contains(g.Namespaces, wildcard) {
+		return true
+	}
+
+	if g.deployments == nil || service == "" {
+		return false
+	}
+	for _, namespace := range g.Namespaces {
+		if g.deployments(namespace, service) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticator maps the tokens accepted by the receiver to their grants.
+// Tokens are only kept hashed so that looking them up does not leak timing
+// information about the valid ones.
+type Authenticator struct {
+	deployments Deployments
+	grants      map[[sha256.Size]byte]*Grant
+}
+
+type AuthenticatorOption func(*Authenticator)
+
+// WithDeployments resolves the namespaces of the grants. Without it, grants
+// by namespace only allow every service through the wildcard.
+func WithDeployments(deployments Deployments) AuthenticatorOption {
+	return func(auth *Authenticator) {
+		auth.deployments = deployments
+	}
+}
+
+func NewAuthenticator(grants map[string]*Grant, options ...AuthenticatorOption) *Authenticator {
+	auth := &Authenticator{grants: make(map[[sha256.Size]byte]*Grant, len(grants))}
+	for _, opt := range options {
+		opt(auth)
+	}
+
+	for token, grant := range grants {
+		scoped := &Grant{deployments: auth.deployments}
+		if grant != nil {
+			scoped.Namespaces = grant.Namespaces
+			scoped.Services = grant.Services
+		}
+		auth.grants[sha256.Sum256([]byte(token))] = scoped
+	}
+
+	return auth
+}
+
+// LoadAuthenticator reads a JSON object mapping each token to its grant.
+// Every grant must list at least a namespace or a service.
+func LoadAuthenticator(path string, options ...AuthenticatorOption) (*Authenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := map[string]*Grant{}
+	if err := json.Unmarshal(data, &grants); err != nil {
+		return nil, err
+	}
+
+	for _, grant := range grants {
+		if grant == nil || (len(grant.Namespaces) == 0 && len(grant.Services) == 0) {
+			return nil, errors.New("every token must be granted at least a namespace or a service")
+		}
+	}
+
+	return NewAuthenticator(grants, options...), nil
+}
+
+func requestToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	for _, value := range md.Get(authorizationHeader) {
+		if strings.HasPrefix(strings.ToLower(value), bearerPrefix) {
+			return strings.TrimSpace(value[len(bearerPrefix):])
+		}
+	}
+
+	if values := md.Get(apiKeyHeader); len(values) > 0 {
+		return strings.TrimSpace(values[0])
+	}
+
+	return ""
+}
+
+// authenticate returns the grant of the token attached to the request. A nil
+// grant allows every resource.
+func (s *server) authenticate(ctx context.Context) (*Grant, error) {
+	if s.auth == nil {
+		return nil, nil
+	}
+
+	token := requestToken(ctx)
+	grant, ok := s.auth.grants[sha256.Sum256([]byte(token))]
+	if token == "" || !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid credentials")
+	}
+
+	return grant, nil
+}
+
+func countSpans(resourceSpans []*tracepb.ResourceSpans) int64 {
+	var count int64
+	for _, resourceSpan := range resourceSpans {
+		for _, scopeSpan := range resourceSpan.ScopeSpans {
+			count += int64(len(scopeSpan.Spans))
+		}
+	}
+
+	return count
+}
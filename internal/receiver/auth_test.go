@@ -0,0 +1,164 @@
+package receiver_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gotest.tools/v3/assert"
+)
+
+func resourceSpans(namespace string, service string, spans int) *tracepb.ResourceSpans {
+	attribute := func(key string, value string) *commonpb.KeyValue {
+		return &commonpb.KeyValue{
+			Key:   key,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+		}
+	}
+
+	resource := &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+		attribute(string(semconv.ServiceNameKey), service),
+	}}
+	if namespace != "" {
+		resource.Attributes = append(resource.Attributes,
+			attribute(string(semconv.ServiceNamespaceKey), namespace))
+	}
+
+	scope := &tracepb.ScopeSpans{}
+	for i := 0; i < spans; i++ {
+		scope.Spans = append(scope.Spans, &tracepb.Span{
+			TraceId: []byte(service),
+			SpanId:  []byte{byte(i)},
+		})
+	}
+
+	return &tracepb.ResourceSpans{Resource: resource, ScopeSpans: []*tracepb.ScopeSpans{scope}}
+}
+
+func TestAuthentication(t *testing.T) {
+	t.Parallel()
+
+	shop := []string{"cart", "checkout"}
+	auth := receiver.NewAuthenticator(map[string]*receiver.Grant{
+		"frontend-token": {Services: []string{"frontend"}},
+		"shop-token":     {Namespaces: []string{"shop"}},
+		"admin-token":    {Services: []string{"*"}},
+	}, receiver.WithDeployments(func(namespace string, service string) bool {
+		return namespace == "shop" && slices.Contains(shop, service)
+	}))
+	ch := make(chan receiver.Batch, 16)
+	recv := receiver.NewOLTPReceiver(
+		receiver.WithAddress("127.0.0.1:0"),
+		receiver.WithAuthenticator(auth),
+		receiver.WithChannel(ch))
+	lis, _ := recv.Start()
+	assert.Assert(t, lis != nil)
+	defer recv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err)
+	defer conn.Close()
+	client := coltracepb.NewTraceServiceClient(conn)
+
+	export := func(headers []string, resources ...*tracepb.ResourceSpans) (*coltracepb.ExportTraceServiceResponse, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if len(headers) > 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, headers...)
+		}
+
+		return client.Export(ctx, &coltracepb.ExportTraceServiceRequest{ResourceSpans: resources})
+	}
+
+	t.Run("missing token", func(t *testing.T) {
+		_, err := export(nil, resourceSpans("", "frontend", 2))
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		_, err := export([]string{"authorization", "Bearer wrong"}, resourceSpans("", "frontend", 1))
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		res, err := export([]string{"authorization", "Bearer frontend-token"},
+			resourceSpans("", "frontend", 2), resourceSpans("", "payments", 3))
+		assert.NilError(t, err)
+		assert.Equal(t, int64(3), res.PartialSuccess.RejectedSpans)
+		assert.Assert(t, res.PartialSuccess.ErrorMessage != "")
+
+		batch := <-ch
+		assert.Equal(t, 2, batch.Len())
+		assert.Equal(t, 1, len(batch))
+	})
+
+	t.Run("api key", func(t *testing.T) {
+		res, err := export([]string{"x-api-key", "shop-token"},
+			resourceSpans("shop", "cart", 1), resourceSpans("shop", "checkout", 1))
+		assert.NilError(t, err)
+		assert.Equal(t, int64(0), res.PartialSuccess.RejectedSpans)
+		assert.Equal(t, 2, (<-ch).Len())
+	})
+
+	t.Run("nothing granted", func(t *testing.T) {
+		_, err := export([]string{"x-api-key", "shop-token"}, resourceSpans("bank", "ledger", 4))
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("reported namespace", func(t *testing.T) {
+		_, err := export([]string{"x-api-key", "shop-token"}, resourceSpans("shop", "ledger", 5))
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("wildcard", func(t *testing.T) {
+		res, err := export([]string{"authorization", "bearer admin-token"},
+			resourceSpans("bank", "ledger", 1), resourceSpans("", "frontend", 1))
+		assert.NilError(t, err)
+		assert.Equal(t, int64(0), res.PartialSuccess.RejectedSpans)
+		assert.Equal(t, 2, (<-ch).Len())
+	})
+
+	assert.Equal(t, uint64(2+1+3+4+5), recv.UnauthorizedSpans())
+	assert.Equal(t, uint64(0), recv.RejectedSpans())
+}
+
+func TestLoadAuthenticator(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	assert.NilError(t, os.WriteFile(path,
+		[]byte(`{"token": {"namespaces": ["shop"], "services": ["frontend"]}}`), 0o600))
+
+	auth, err := receiver.LoadAuthenticator(path)
+	assert.NilError(t, err)
+	assert.Assert(t, auth != nil)
+
+	assert.NilError(t, os.WriteFile(path, []byte(`["token"]`), 0o600))
+	_, err = receiver.LoadAuthenticator(path)
+	assert.Assert(t, err != nil)
+
+	for _, grants := range []string{`{"token": null}`, `{"token": {}}`, `{"token": {"services": []}}`} {
+		assert.NilError(t, os.WriteFile(path, []byte(grants), 0o600))
+		_, err = receiver.LoadAuthenticator(path)
+		assert.Assert(t, err != nil, grants)
+	}
+
+	_, err = receiver.LoadAuthenticator(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Assert(t, err != nil)
+}
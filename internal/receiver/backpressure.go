@@ -0,0 +1,102 @@
+package receiver
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+type Policy int
+
+const (
+	PolicyBlock Policy = iota
+	PolicyDropNewest
+	PolicySample
+)
+
+var policyNames = map[Policy]string{
+	PolicyBlock:      "block",
+	PolicyDropNewest: "drop-newest",
+	PolicySample:     "sample",
+}
+
+func (p Policy) String() string {
+	return policyNames[p]
+}
+
+func (p *Policy) Set(value string) error {
+	for policy, name := range policyNames {
+		if name == value {
+			*p = policy
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown backpressure policy %q", value)
+}
+
+// sampleThreshold is the buffer occupancy above which PolicySample starts
+// admitting only a subset of the traces.
+const sampleThreshold = 0.5
+
+// traceHash maps a trace ID to a uniformly distributed value. FNV alone
+// barely changes the high bits for IDs that differ only in their last bytes,
+// so its output goes through a 64 bit finalizer.
+func traceHash(traceId string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(traceId))
+
+	value := hash.Sum64()
+	value ^= value >> 33
+	value *= 0xff51afd7ed558ccd
+	value ^= value >> 33
+	value *= 0xc4ceb9fe1a85ec53
+	value ^= value >> 33
+
+	return value
+}
+
+// sample removes from the batch the traces that are not admitted at the
+// current buffer occupancy and returns the number of spans it dropped.
+func (s *server) sample(batch Batch) int64 {
+	capacity := cap(s.ch)
+	if capacity == 0 {
+		return 0
+	}
+
+	occupancy := float64(len(s.ch)) / float64(capacity)
+	if occupancy < sampleThreshold {
+		return 0
+	}
+
+	var dropped int64
+
+	keep := (1 - occupancy) / (1 - sampleThreshold)
+	for traceId, spans := range batch {
+		if float64(traceHash(traceId)) >= keep*math.MaxUint64 {
+			dropped += int64(len(spans))
+			delete(batch, traceId)
+		}
+	}
+
+	return dropped
+}
+
+func (s *server) send(ctx context.Context, batch Batch) bool {
+	if s.policy == PolicyBlock {
+		select {
+		case s.ch <- batch:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	select {
+	case s.ch <- batch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,141 @@
+package receiver_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"gotest.tools/v3/assert"
+)
+
+func overloadRequest(traces int, spansPerTrace int) *coltracepb.ExportTraceServiceRequest {
+	spans := make([]*tracepb.Span, 0, traces*spansPerTrace)
+	for i := 0; i < traces; i++ {
+		for j := 0; j < spansPerTrace; j++ {
+			spans = append(spans, &tracepb.Span{
+				TraceId: []byte(fmt.Sprintf("trace-%04d", i)),
+				SpanId:  []byte(fmt.Sprintf("span-%04d", j)),
+			})
+		}
+	}
+
+	return &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: spans}},
+		}},
+	}
+}
+
+func exportWithPolicy(t *testing.T, ch chan receiver.Batch, policy receiver.Policy,
+	requests ...*coltracepb.ExportTraceServiceRequest,
+) ([]*coltracepb.ExportTraceServiceResponse, []error, *receiver.OTLPReceiver) {
+	t.Helper()
+
+	recv := receiver.NewOLTPReceiver(
+		receiver.WithChannel(ch),
+		receiver.WithAddress("127.0.0.1:0"),
+		receiver.WithPolicy(policy),
+		receiver.WithRetryDelay(3*time.Second))
+	lis, _ := recv.Start()
+	assert.Assert(t, lis != nil)
+	defer recv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err)
+	defer conn.Close()
+
+	client := coltracepb.NewTraceServiceClient(conn)
+	responses := make([]*coltracepb.ExportTraceServiceResponse, 0, len(requests))
+	errs := make([]error, 0, len(requests))
+	for _, request := range requests {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		res, err := client.Export(ctx, request)
+		cancel()
+		responses = append(responses, res)
+		errs = append(errs, err)
+	}
+
+	return responses, errs, recv
+}
+
+func TestDropNewest(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan receiver.Batch, 1)
+	responses, errs, recv := exportWithPolicy(t, ch, receiver.PolicyDropNewest,
+		overloadRequest(1, 2), overloadRequest(2, 2))
+
+	assert.NilError(t, errs[0])
+	assert.Equal(t, int64(0), responses[0].PartialSuccess.RejectedSpans)
+
+	st, ok := status.FromError(errs[1])
+	assert.Assert(t, ok)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Equal(t, 1, len(st.Details()))
+	retry, ok := st.Details()[0].(*errdetails.RetryInfo)
+	assert.Assert(t, ok)
+	assert.Equal(t, 3*time.Second, retry.RetryDelay.AsDuration())
+
+	assert.Equal(t, uint64(4), recv.RejectedSpans())
+	assert.Equal(t, 1, len(ch))
+	assert.Equal(t, 2, (<-ch).Len())
+}
+
+func TestSampleTraces(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan receiver.Batch, 4)
+	for i := 0; i < 3; i++ {
+		ch <- receiver.Batch{}
+	}
+	responses, errs, recv := exportWithPolicy(t, ch, receiver.PolicySample, overloadRequest(100, 4))
+
+	assert.NilError(t, errs[0])
+	rejected := responses[0].PartialSuccess.RejectedSpans
+	assert.Assert(t, rejected > 0 && rejected < 400)
+	assert.Equal(t, uint64(rejected), recv.RejectedSpans())
+	assert.Equal(t, int64(0), rejected%4, "traces must be kept or dropped as a whole")
+
+	for i := 0; i < 3; i++ {
+		<-ch
+	}
+	batch := <-ch
+	assert.Equal(t, int64(batch.Len()), 400-rejected)
+	for traceId, spans := range batch {
+		if len(spans) != 4 {
+			t.Errorf("trace %s was only partially admitted: %d spans", traceId, len(spans))
+		}
+	}
+}
+
+func TestBlockCancelled(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan receiver.Batch, 1)
+	ch <- receiver.Batch{}
+	_, errs, _ := exportWithPolicy(t, ch, receiver.PolicyBlock, overloadRequest(1, 2))
+
+	assert.Assert(t, errs[0] != nil)
+	assert.Equal(t, 0, (<-ch).Len())
+}
+
+func TestPolicyFlag(t *testing.T) {
+	t.Parallel()
+
+	var policy receiver.Policy
+	for _, name := range []string{"block", "drop-newest", "sample"} {
+		assert.NilError(t, policy.Set(name))
+		assert.Equal(t, name, policy.String())
+	}
+	assert.Assert(t, policy.Set("unknown") != nil)
+}
@@ -0,0 +1,57 @@
+package receiver_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func BenchmarkExport(b *testing.B) {
+	for _, spans := range []int{1, 10, 100, 1000} {
+		b.Run(fmt.Sprintf("spans=%d", spans), func(b *testing.B) {
+			ch := make(chan receiver.Batch, 64)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for range ch {
+				}
+			}()
+
+			recv := receiver.NewOLTPReceiver(
+				receiver.WithChannel(ch),
+				receiver.WithAddress("127.0.0.1:0"))
+			lis, _ := recv.Start()
+			if lis == nil {
+				b.Fatal("failed to start the receiver")
+			}
+
+			conn, err := grpc.NewClient(lis.Addr().String(),
+				grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			client := coltracepb.NewTraceServiceClient(conn)
+			request := overloadRequest(spans, 1)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.Export(context.Background(), request); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(b.N*spans)/b.Elapsed().Seconds(), "spans/s")
+
+			conn.Close()
+			recv.Stop()
+			close(ch)
+			<-done
+		})
+	}
+}
@@ -7,43 +7,143 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
 	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	overloadedMessage   = "the receiver is overloaded"
+	unauthorizedMessage = "spans reported for services outside the granted ones"
 )
 
 func (s *server) Export(
 	ctx context.Context, in *coltracepb.ExportTraceServiceRequest,
 ) (*coltracepb.ExportTraceServiceResponse, error) {
+	grant, err := s.authenticate(ctx)
+	if err != nil {
+		s.unauthorized.Add(uint64(countSpans(in.ResourceSpans)))
+		return nil, err
+	}
+
+	var denied int64
+
+	allowed := make([]*tracepb.ResourceSpans, 0, len(in.ResourceSpans))
+	batch := Batch{}
 	for _, resourceSpan := range in.ResourceSpans {
-		serviceName := extractServiceName(resourceSpan)
+		serviceName := extractAttribute(resourceSpan, string(semconv.ServiceNameKey))
+		pod := extractAttribute(resourceSpan, string(semconv.K8SPodNameKey))
+		if !grant.allows(serviceName) {
+			denied += countSpans([]*tracepb.ResourceSpans{resourceSpan})
+			continue
+		}
+		allowed = append(allowed, resourceSpan)
 
 		for _, scopeSpan := range resourceSpan.ScopeSpans {
 			for _, span := range scopeSpan.Spans {
-				s.ch <- &Span{
+				batch.Add(&Span{
 					Duration:    span.EndTimeUnixNano - span.StartTimeUnixNano,
 					Parent:      hex.EncodeToString(span.ParentSpanId),
+					Pod:         pod,
 					ServiceName: serviceName,
 					SpanId:      hex.EncodeToString(span.SpanId),
 					StartTime:   span.StartTimeUnixNano,
 					TraceId:     hex.EncodeToString(span.TraceId),
-				}
+				})
 			}
 		}
 
 	}
 
+	if len(allowed) == len(in.ResourceSpans) {
+		s.forward(in)
+	} else if len(allowed) > 0 {
+		s.forward(&coltracepb.ExportTraceServiceRequest{ResourceSpans: allowed})
+	}
+
+	rejected, message, err := s.deliver(ctx, batch, denied)
+	if err != nil && len(allowed) > 0 && len(s.forwarders) > 0 && status.Code(err) == codes.ResourceExhausted {
+		// retrying would forward the request again
+		message, err = overloadedMessage, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	return &coltracepb.ExportTraceServiceResponse{
 		PartialSuccess: &coltracepb.ExportTracePartialSuccess{
-			RejectedSpans: 0,
+			RejectedSpans: rejected,
+			ErrorMessage:  message,
 		},
 	}, nil
 }
 
-func extractServiceName(spans *tracepb.ResourceSpans) string {
+// forward passes the request on to every downstream endpoint, regardless of
+// whether the observer keeps up with it. Requests that were forwarded are
+// never answered with a retryable error.
+func (s *server) forward(in *coltracepb.ExportTraceServiceRequest) {
+	for _, forwarder := range s.forwarders {
+		forwarder.Forward(in)
+	}
+}
+
+// deliver hands a batch to the observer according to the receiver policy.
+// denied is the number of spans of the request that were already dropped for
+// lack of permissions. It returns the number of spans rejected overall and a
+// message explaining why, or an error if no span was accepted.
+func (s *server) deliver(ctx context.Context, batch Batch, denied int64) (int64, string, error) {
+	if denied > 0 {
+		s.unauthorized.Add(uint64(denied))
+		if len(batch) == 0 {
+			return denied, "", status.Error(codes.PermissionDenied, unauthorizedMessage)
+		}
+	}
+
+	total := int64(batch.Len())
+	rejected := int64(0)
+	if s.policy == PolicySample {
+		rejected = s.sample(batch)
+	}
+	if len(batch) > 0 && !s.send(ctx, batch) {
+		rejected = total
+	}
+
+	if rejected > 0 {
+		s.rejected.Add(uint64(rejected))
+	}
+
+	switch {
+	case denied > 0 && rejected > 0:
+		return denied + rejected, unauthorizedMessage + "; " + overloadedMessage, nil
+	case denied > 0:
+		return denied, unauthorizedMessage, nil
+	case rejected > 0 && rejected == total:
+		return rejected, "", s.overloaded()
+	case rejected > 0:
+		return rejected, overloadedMessage, nil
+	default:
+		return 0, "", nil
+	}
+}
+
+func (s *server) overloaded() error {
+	st, err := status.New(codes.ResourceExhausted, overloadedMessage).
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(s.retryDelay)})
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, overloadedMessage)
+	}
+
+	return st.Err()
+}
+
+func extractAttribute(spans *tracepb.ResourceSpans, key string) string {
 	if spans.Resource == nil || spans.Resource.Attributes == nil {
 		return ""
 	}
 
 	for _, attribute := range spans.Resource.Attributes {
-		if attribute.Key == string(semconv.ServiceNameKey) {
+		if attribute.Key == key {
 			return attribute.Value.GetStringValue()
 		}
 	}
@@ -162,7 +162,7 @@ func newTestSpans(t *testing.T, generateOption int) *testSpans {
 	return spans
 }
 
-func (t *testSpans) received(ch <-chan *receiver.Span, errCh <-chan error) cmp.Comparison {
+func (t *testSpans) received(ch <-chan receiver.Batch, errCh <-chan error) cmp.Comparison {
 	compareSpans := func(value *receiver.Span, expected *tracepb.ResourceSpans, serviceName string) bool {
 		span := expected.ScopeSpans[0].Spans[0]
 
@@ -178,25 +178,34 @@ func (t *testSpans) received(ch <-chan *receiver.Span, errCh <-chan error) cmp.C
 	return func() cmp.Result {
 		processed := make([]bool, len(t.spans))
 
-		for received := 0; received < len(t.spans); received++ {
+		for received := 0; received < len(t.spans); {
 			select {
-			case span := <-ch:
-
-				index := -1
-				for i, testSpan := range t.spans {
-					if !processed[i] && compareSpans(span, testSpan, t.serviceNames[i]) {
-						index = i
-						processed[i] = true
-
-						break
+			case batch := <-ch:
+				for traceId, spans := range batch {
+					for _, span := range spans {
+						if span.TraceId != traceId {
+							return cmp.ResultFailure(
+								fmt.Sprintf("Span %v grouped under trace %s", span, traceId))
+						}
+
+						index := -1
+						for i, testSpan := range t.spans {
+							if !processed[i] && compareSpans(span, testSpan, t.serviceNames[i]) {
+								index = i
+								processed[i] = true
+
+								break
+							}
+						}
+
+						if index == -1 {
+							return cmp.ResultFailure(
+								fmt.Sprintf("Received unexpected span: %v", span))
+						}
+						received += 1
 					}
 				}
 
-				if index == -1 {
-					return cmp.ResultFailure(
-						fmt.Sprintf("Received unexpected span: %v", span))
-				}
-
 			case <-time.After(time.Second):
 				return cmp.ResultFailure("Failed to receive spans")
 
@@ -215,7 +224,7 @@ func submitSpansTest(t *testing.T, generateOption int, batchSize int) {
 	t.Parallel()
 
 	tests := newTestSpans(t, generateOption)
-	ch := make(chan *receiver.Span)
+	ch := make(chan receiver.Batch)
 	recv := receiver.NewOLTPReceiver(
 		receiver.WithChannel(ch),
 		receiver.WithAddress("127.0.0.1:0"))
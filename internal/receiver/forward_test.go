@@ -0,0 +1,94 @@
+package receiver_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pako-23/queue-scaler/internal/forward"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"gotest.tools/v3/assert"
+)
+
+type downstream struct {
+	coltracepb.UnimplementedTraceServiceServer
+	requests chan *coltracepb.ExportTraceServiceRequest
+}
+
+func (d *downstream) Export(
+	ctx context.Context, in *coltracepb.ExportTraceServiceRequest,
+) (*coltracepb.ExportTraceServiceResponse, error) {
+	d.requests <- in
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+func TestForwarding(t *testing.T) {
+	t.Parallel()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	d := &downstream{requests: make(chan *coltracepb.ExportTraceServiceRequest, 4)}
+	server := grpc.NewServer()
+	coltracepb.RegisterTraceServiceServer(server, d)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	forwarder, err := forward.NewForwarder(lis.Addr().String())
+	assert.NilError(t, err)
+
+	auth := receiver.NewAuthenticator(map[string]*receiver.Grant{
+		"frontend-token": {Services: []string{"frontend"}},
+	})
+	// spans are forwarded even though the observer is not keeping up
+	recv := receiver.NewOLTPReceiver(
+		receiver.WithAddress("127.0.0.1:0"),
+		receiver.WithAuthenticator(auth),
+		receiver.WithChannel(make(chan receiver.Batch)),
+		receiver.WithForwarder(forwarder),
+		receiver.WithPolicy(receiver.PolicyDropNewest))
+	recvLis, _ := recv.Start()
+	assert.Assert(t, recvLis != nil)
+
+	conn, err := grpc.NewClient(recvLis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err)
+	defer conn.Close()
+	client := coltracepb.NewTraceServiceClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer frontend-token")
+	_, err = client.Export(ctx, &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{
+			resourceSpans("", "frontend", 2),
+			resourceSpans("", "cart", 1),
+		},
+	})
+	assert.NilError(t, err)
+
+	// the observer drops the spans, which are not retried since they were
+	// already forwarded
+	res, err := client.Export(ctx, &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{resourceSpans("", "frontend", 3)},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, res.PartialSuccess.RejectedSpans, int64(3))
+
+	_, err = client.Export(context.Background(), &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{resourceSpans("", "frontend", 1)},
+	})
+	assert.Assert(t, err != nil)
+
+	recv.Stop()
+	assert.NilError(t, forwarder.Shutdown(context.Background()))
+
+	assert.Equal(t, len(d.requests), 2)
+	forwarded := <-d.requests
+	assert.Equal(t, len(forwarded.ResourceSpans), 1)
+	assert.Equal(t, len(forwarded.ResourceSpans[0].ScopeSpans[0].Spans), 2)
+	assert.Equal(t, len((<-d.requests).ResourceSpans[0].ScopeSpans[0].Spans), 3)
+	assert.Equal(t, forwarder.ForwardedSpans(), uint64(5))
+}
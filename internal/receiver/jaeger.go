@@ -0,0 +1,77 @@
+package receiver
+
+import (
+	"context"
+	"fmt"
+
+	model "github.com/jaegertracing/jaeger-idl/model/v1"
+	"github.com/jaegertracing/jaeger-idl/proto-gen/api_v2"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+)
+
+type jaegerServer struct {
+	*server
+}
+
+// PostSpans translates a Jaeger api_v2 batch into spans. Jaeger has no notion
+// of partial success, so spans rejected by the policy are only counted.
+func (s *jaegerServer) PostSpans(
+	ctx context.Context, in *api_v2.PostSpansRequest,
+) (*api_v2.PostSpansResponse, error) {
+	grant, err := s.authenticate(ctx)
+	if err != nil {
+		s.unauthorized.Add(uint64(len(in.Batch.Spans)))
+		return nil, err
+	}
+
+	var denied int64
+
+	batch := Batch{}
+	for _, span := range in.Batch.Spans {
+		process := span.Process
+		if process == nil {
+			process = in.Batch.Process
+		}
+
+		serviceName, pod := jaegerService(process)
+		if !grant.allows(serviceName) {
+			denied++
+			continue
+		}
+
+		parent := ""
+		if id := span.ParentSpanID(); id != 0 {
+			parent = id.String()
+		}
+
+		batch.Add(&Span{
+			Duration:    uint64(span.Duration.Nanoseconds()),
+			Parent:      parent,
+			Pod:         pod,
+			ServiceName: serviceName,
+			SpanId:      span.SpanID.String(),
+			StartTime:   uint64(span.StartTime.UnixNano()),
+			TraceId:     fmt.Sprintf("%016x%016x", span.TraceID.High, span.TraceID.Low),
+		})
+	}
+
+	if _, _, err := s.deliver(ctx, batch, denied); err != nil {
+		return nil, err
+	}
+
+	return &api_v2.PostSpansResponse{}, nil
+}
+
+// jaegerService returns the service name and pod of a process.
+func jaegerService(process *model.Process) (string, string) {
+	if process == nil {
+		return "", ""
+	}
+
+	pod := ""
+	if tag, ok := model.KeyValues(process.Tags).FindByKey(string(semconv.K8SPodNameKey)); ok {
+		pod = tag.AsString()
+	}
+
+	return process.ServiceName, pod
+}
@@ -0,0 +1,86 @@
+package receiver_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	model "github.com/jaegertracing/jaeger-idl/model/v1"
+	"github.com/jaegertracing/jaeger-idl/proto-gen/api_v2"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"gotest.tools/v3/assert"
+)
+
+func TestJaeger(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan receiver.Batch, 1)
+	recv := receiver.NewOLTPReceiver(
+		receiver.WithAddress("127.0.0.1:0"),
+		receiver.WithChannel(ch),
+		receiver.WithJaeger())
+	lis, _ := recv.Start()
+	assert.Assert(t, lis != nil)
+	defer recv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err)
+	defer conn.Close()
+	client := api_v2.NewCollectorServiceClient(conn)
+
+	traceId := model.NewTraceID(1, 2)
+	start := time.Unix(10, 0)
+	_, err = client.PostSpans(context.Background(), &api_v2.PostSpansRequest{
+		Batch: model.Batch{
+			Process: &model.Process{ServiceName: "frontend"},
+			Spans: []*model.Span{
+				{
+					TraceID:   traceId,
+					SpanID:    model.NewSpanID(3),
+					StartTime: start,
+					Duration:  time.Millisecond,
+				},
+				{
+					TraceID:    traceId,
+					SpanID:     model.NewSpanID(4),
+					References: []model.SpanRef{model.NewChildOfRef(traceId, model.NewSpanID(3))},
+					StartTime:  start,
+					Duration:   time.Microsecond,
+					Process: &model.Process{
+						ServiceName: "backend",
+						Tags:        []model.KeyValue{model.String(string(semconv.K8SPodNameKey), "backend-1")},
+					},
+				},
+			},
+		},
+	})
+	assert.NilError(t, err)
+
+	select {
+	case batch := <-ch:
+		spans := batch["00000000000000010000000000000002"]
+		assert.Equal(t, len(spans), 2)
+		assert.DeepEqual(t, *spans[0], receiver.Span{
+			Duration:    uint64(time.Millisecond),
+			ServiceName: "frontend",
+			SpanId:      "0000000000000003",
+			StartTime:   uint64(start.UnixNano()),
+			TraceId:     "00000000000000010000000000000002",
+		})
+		assert.DeepEqual(t, *spans[1], receiver.Span{
+			Duration:    uint64(time.Microsecond),
+			Parent:      "0000000000000003",
+			Pod:         "backend-1",
+			ServiceName: "backend",
+			SpanId:      "0000000000000004",
+			StartTime:   uint64(start.UnixNano()),
+			TraceId:     "00000000000000010000000000000002",
+		})
+	case <-time.After(time.Second):
+		t.Fatal("no batch received")
+	}
+}
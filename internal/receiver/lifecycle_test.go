@@ -0,0 +1,159 @@
+package receiver_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"gotest.tools/v3/assert"
+)
+
+func startReceiver(t *testing.T, options ...receiver.Option) (*receiver.OTLPReceiver, *grpc.ClientConn) {
+	t.Helper()
+
+	recv := receiver.NewOLTPReceiver(append(options, receiver.WithAddress("127.0.0.1:0"))...)
+	lis, _ := recv.Start()
+	assert.Assert(t, lis != nil)
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err)
+
+	return recv, conn
+}
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+
+	recv, conn := startReceiver(t)
+	defer recv.Stop()
+	defer conn.Close()
+
+	client := healthpb.NewHealthClient(conn)
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		res, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		assert.NilError(t, err)
+
+		return res.Status
+	}
+
+	services := []string{"", coltracepb.TraceService_ServiceDesc.ServiceName}
+	for _, service := range services {
+		assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, check(service))
+	}
+
+	recv.SetServing(true)
+	for _, service := range services {
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, check(service))
+	}
+}
+
+func TestReflection(t *testing.T) {
+	t.Parallel()
+
+	listServices := func(options ...receiver.Option) ([]string, error) {
+		recv, conn := startReceiver(t, options...)
+		defer recv.Stop()
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+		assert.NilError(t, err)
+		err = stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		})
+		assert.NilError(t, err)
+
+		res, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+
+		services := []string{}
+		for _, service := range res.GetListServicesResponse().Service {
+			services = append(services, service.Name)
+		}
+
+		return services, nil
+	}
+
+	services, err := listServices(receiver.WithReflection())
+	assert.NilError(t, err)
+	assert.Assert(t, len(services) >= 2)
+	assert.Assert(t, contains(services, coltracepb.TraceService_ServiceDesc.ServiceName))
+	assert.Assert(t, contains(services, healthpb.Health_ServiceDesc.ServiceName))
+
+	_, err = listServices()
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func contains(values []string, value string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestGracefulStop(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan receiver.Batch)
+	recv, conn := startReceiver(t, receiver.WithChannel(ch))
+	defer conn.Close()
+
+	exported := make(chan error, 1)
+	go func() {
+		_, err := coltracepb.NewTraceServiceClient(conn).Export(context.Background(), overloadRequest(1, 2))
+		exported <- err
+	}()
+
+	// let the export reach the receiver before stopping it
+	time.Sleep(100 * time.Millisecond)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		recv.Stop()
+	}()
+
+	batch := <-ch
+	assert.Equal(t, 2, batch.Len())
+	assert.NilError(t, <-exported)
+	<-stopped
+}
+
+func TestStopTimeout(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan receiver.Batch)
+	recv, conn := startReceiver(t, receiver.WithChannel(ch), receiver.WithStopTimeout(100*time.Millisecond))
+	defer conn.Close()
+
+	exported := make(chan error, 1)
+	go func() {
+		_, err := coltracepb.NewTraceServiceClient(conn).Export(context.Background(), overloadRequest(1, 2))
+		exported <- err
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	recv.Stop()
+	assert.Assert(t, time.Since(start) < time.Second)
+	assert.Assert(t, <-exported != nil)
+	assert.Equal(t, uint64(2), recv.RejectedSpans())
+}
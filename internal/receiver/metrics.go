@@ -0,0 +1,366 @@
+package receiver
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+const (
+	clientAttribute   = "client"
+	serverAttribute   = "server"
+	consumerSpanKind  = "SPAN_KIND_CONSUMER"
+	serverSpanKind    = "SPAN_KIND_SERVER"
+	spanKindAttribute = "span.kind"
+
+	// seriesTTL is how long a cumulative series is remembered after its
+	// last point.
+	seriesTTL = 10 * time.Minute
+
+	// serviceGraphUser is the client the servicegraph connector reports for
+	// requests coming from outside the traced services.
+	serviceGraphUser = "user"
+)
+
+// DurationMetrics are the histograms of request durations, as exported by
+// instrumentation libraries and the spanmetrics connector.
+var DurationMetrics = append([]string{
+	"traces.span.metrics.duration",
+	"traces_span_metrics_duration",
+}, serverDurationMetrics...)
+
+// serverDurationMetrics only measure requests served. Other duration metrics
+// cover every span kind, of which only server and consumer spans count.
+var serverDurationMetrics = []string{
+	"http.server.request.duration",
+	"rpc.server.duration",
+}
+
+// ServiceGraphMetrics are the counters of calls between a client and a server
+// service, as exported by the servicegraph connector.
+var ServiceGraphMetrics = []string{
+	"traces_service_graph_request_total",
+	"traces.service.graph.request.total",
+}
+
+// nanoseconds converts a duration in the given unit to nanoseconds.
+var nanoseconds = map[string]float64{
+	"":   1e9,
+	"s":  1e9,
+	"ms": 1e6,
+	"us": 1e3,
+	"ns": 1,
+}
+
+// Edge is a call from a client service to a server service.
+type Edge struct {
+	Client string
+	Server string
+}
+
+// ServiceMetrics sums the requests a service served.
+type ServiceMetrics struct {
+	Count       uint64
+	DurationSum uint64
+}
+
+// Metrics holds the requests reported through metrics since the previous
+// export, as an alternative to spans.
+type Metrics struct {
+	Calls    map[Edge]uint64
+	Services map[string]*ServiceMetrics
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Calls:    map[Edge]uint64{},
+		Services: map[string]*ServiceMetrics{},
+	}
+}
+
+func (m *Metrics) Empty() bool {
+	return len(m.Calls) == 0 && len(m.Services) == 0
+}
+
+func (m *Metrics) addService(service string, count uint64, durationSum uint64) {
+	if count == 0 {
+		return
+	}
+
+	if _, ok := m.Services[service]; !ok {
+		m.Services[service] = &ServiceMetrics{}
+	}
+	m.Services[service].Count += count
+	m.Services[service].DurationSum += durationSum
+}
+
+type cumulative struct {
+	count uint64
+	seen  time.Time
+	start uint64
+	sum   float64
+}
+
+// seriesStore turns cumulative data points into deltas by remembering the
+// previous point of every series. Series without points for seriesTTL are
+// forgotten.
+type seriesStore struct {
+	lock   sync.Mutex
+	series map[string]cumulative
+	swept  time.Time
+}
+
+func newSeriesStore() *seriesStore {
+	return &seriesStore{series: map[string]cumulative{}, swept: time.Now()}
+}
+
+// delta returns the increase of a series since its previous point. The first
+// point of a series only sets the baseline. A decrease or a new start time
+// means the series was reset. The point only becomes the baseline of the
+// series once committed.
+func (s *seriesStore) delta(key string, point cumulative) (uint64, float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	previous, ok := s.series[key]
+	if !ok {
+		return 0, 0
+	}
+
+	if point.start != previous.start || point.count < previous.count {
+		return point.count, point.sum
+	}
+
+	return point.count - previous.count, point.sum - previous.sum
+}
+
+// commit makes points the baselines of their series, once the deltas they
+// produced were delivered.
+func (s *seriesStore) commit(points map[string]cumulative) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for key, point := range points {
+		point.seen = now
+		s.series[key] = point
+	}
+
+	if now.Sub(s.swept) < seriesTTL {
+		return
+	}
+	for key, point := range s.series {
+		if now.Sub(point.seen) >= seriesTTL {
+			delete(s.series, key)
+		}
+	}
+	s.swept = now
+}
+
+func seriesKey(metric string, resource string, attributes []*commonpb.KeyValue) string {
+	parts := make([]string, 0, len(attributes))
+	for _, attribute := range attributes {
+		parts = append(parts, attribute.Key+"="+attribute.Value.String())
+	}
+	slices.Sort(parts)
+
+	return metric + "|" + resource + "|" + strings.Join(parts, ",")
+}
+
+func attribute(attributes []*commonpb.KeyValue, key string) (string, bool) {
+	for _, attribute := range attributes {
+		if attribute.Key == key {
+			return attribute.Value.GetStringValue(), true
+		}
+	}
+
+	return "", false
+}
+
+type metricsServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	*server
+	ch     chan<- *Metrics
+	series *seriesStore
+}
+
+// point returns the increase measured by a data point. Cumulative points are
+// added to pending, to become baselines once the increase is delivered.
+func (s *metricsServer) point(
+	key string, temporality metricspb.AggregationTemporality, point cumulative, pending map[string]cumulative,
+) (uint64, float64) {
+	if temporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA {
+		return point.count, point.sum
+	}
+
+	pending[key] = point
+	return s.series.delta(key, point)
+}
+
+func (s *metricsServer) addDurations(
+	metrics *Metrics, service string, resource string, metric *metricspb.Metric, pending map[string]cumulative,
+) {
+	scale, ok := nanoseconds[metric.Unit]
+	if !ok {
+		return
+	}
+
+	type dataPoint struct {
+		attributes []*commonpb.KeyValue
+		point      cumulative
+	}
+
+	var (
+		points      []dataPoint
+		temporality metricspb.AggregationTemporality
+	)
+	switch data := metric.Data.(type) {
+	case *metricspb.Metric_Histogram:
+		temporality = data.Histogram.AggregationTemporality
+		for _, point := range data.Histogram.DataPoints {
+			if point.Sum == nil {
+				continue
+			}
+			points = append(points, dataPoint{point.Attributes,
+				cumulative{count: point.Count, start: point.StartTimeUnixNano, sum: point.GetSum()}})
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		temporality = data.ExponentialHistogram.AggregationTemporality
+		for _, point := range data.ExponentialHistogram.DataPoints {
+			if point.Sum == nil {
+				continue
+			}
+			points = append(points, dataPoint{point.Attributes,
+				cumulative{count: point.Count, start: point.StartTimeUnixNano, sum: point.GetSum()}})
+		}
+	default:
+		return
+	}
+
+	for _, point := range points {
+		if kind, _ := attribute(point.attributes, spanKindAttribute); kind != serverSpanKind && kind != consumerSpanKind &&
+			!slices.Contains(serverDurationMetrics, metric.Name) {
+			continue
+		}
+
+		count, sum := s.point(seriesKey(metric.Name, resource, point.attributes),
+			temporality, point.point, pending)
+		metrics.addService(service, count, uint64(max(sum, 0)*scale))
+	}
+}
+
+// addCalls returns the number of data points denied to the grant.
+func (s *metricsServer) addCalls(
+	metrics *Metrics, grant *Grant, resource string, metric *metricspb.Metric, pending map[string]cumulative,
+) int64 {
+	sum := metric.GetSum()
+	if sum == nil {
+		return 0
+	}
+
+	denied := int64(0)
+	for _, point := range sum.DataPoints {
+		client, _ := attribute(point.Attributes, clientAttribute)
+		server, ok := attribute(point.Attributes, serverAttribute)
+		if !ok || client == server || client == serviceGraphUser {
+			continue
+		}
+		if !grant.allows(server) {
+			denied++
+			continue
+		}
+
+		value := cumulative{start: point.StartTimeUnixNano}
+		switch number := point.Value.(type) {
+		case *metricspb.NumberDataPoint_AsInt:
+			value.count = uint64(max(number.AsInt, 0))
+		case *metricspb.NumberDataPoint_AsDouble:
+			value.count = uint64(max(number.AsDouble, 0))
+		}
+
+		count, _ := s.point(seriesKey(metric.Name, resource, point.Attributes),
+			sum.AggregationTemporality, value, pending)
+		if count > 0 {
+			metrics.Calls[Edge{Client: client, Server: server}] += count
+		}
+	}
+
+	return denied
+}
+
+// Export derives request counts and durations from server duration
+// histograms, and calls between services from service graph counters.
+// Every other metric is ignored.
+func (s *metricsServer) Export(
+	ctx context.Context, in *colmetricspb.ExportMetricsServiceRequest,
+) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	grant, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := NewMetrics()
+	pending := map[string]cumulative{}
+	denied := int64(0)
+	for _, resourceMetric := range in.ResourceMetrics {
+		var resourceAttributes []*commonpb.KeyValue
+		if resourceMetric.Resource != nil {
+			resourceAttributes = resourceMetric.Resource.Attributes
+		}
+		resource := seriesKey("", "", resourceAttributes)
+		service, _ := attribute(resourceAttributes, string(semconv.ServiceNameKey))
+
+		for _, scopeMetric := range resourceMetric.ScopeMetrics {
+			for _, metric := range scopeMetric.Metrics {
+				switch {
+				case slices.Contains(ServiceGraphMetrics, metric.Name):
+					denied += s.addCalls(metrics, grant, resource, metric, pending)
+				case slices.Contains(DurationMetrics, metric.Name) && service != "":
+					if !grant.allows(service) {
+						denied += int64(len(metric.GetHistogram().GetDataPoints()) +
+							len(metric.GetExponentialHistogram().GetDataPoints()))
+						continue
+					}
+					s.addDurations(metrics, service, resource, metric, pending)
+				}
+			}
+		}
+	}
+
+	response := &colmetricspb.ExportMetricsServiceResponse{}
+	if denied > 0 {
+		response.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: denied,
+			ErrorMessage:       unauthorizedMessage,
+		}
+	}
+
+	if metrics.Empty() {
+		s.series.commit(pending)
+		return response, nil
+	}
+
+	if s.policy == PolicyBlock {
+		select {
+		case s.ch <- metrics:
+		case <-ctx.Done():
+			return nil, s.overloaded()
+		}
+	} else {
+		select {
+		case s.ch <- metrics:
+		default:
+			return nil, s.overloaded()
+		}
+	}
+	s.series.commit(pending)
+
+	return response, nil
+}
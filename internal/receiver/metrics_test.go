@@ -0,0 +1,167 @@
+package receiver_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"gotest.tools/v3/assert"
+)
+
+func stringAttribute(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func durationMetric(kind string, count uint64, sum float64, start uint64) *metricspb.Metric {
+	var attributes []*commonpb.KeyValue
+	if kind != "" {
+		attributes = append(attributes, stringAttribute("span.kind", kind))
+	}
+
+	return &metricspb.Metric{
+		Name: "traces.span.metrics.duration",
+		Unit: "ms",
+		Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints: []*metricspb.HistogramDataPoint{{
+				Attributes:        attributes,
+				Count:             count,
+				StartTimeUnixNano: start,
+				Sum:               &sum,
+			}},
+		}},
+	}
+}
+
+func callsMetric(client string, server string, calls int64) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: "traces_service_graph_request_total",
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			IsMonotonic:            true,
+			DataPoints: []*metricspb.NumberDataPoint{{
+				Attributes: []*commonpb.KeyValue{
+					stringAttribute("client", client),
+					stringAttribute("server", server),
+				},
+				Value: &metricspb.NumberDataPoint_AsInt{AsInt: calls},
+			}},
+		}},
+	}
+}
+
+func metricsRequest(service string, metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: []*metricspb.ResourceMetrics{{
+		Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+			stringAttribute("service.name", service),
+		}},
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+	}}}
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan *receiver.Metrics, 4)
+	recv := receiver.NewOLTPReceiver(
+		receiver.WithAddress("127.0.0.1:0"),
+		receiver.WithMetrics(ch))
+	lis, _ := recv.Start()
+	assert.Assert(t, lis != nil)
+	defer recv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err)
+	defer conn.Close()
+	client := colmetricspb.NewMetricsServiceClient(conn)
+
+	export := func(request *colmetricspb.ExportMetricsServiceRequest) *receiver.Metrics {
+		t.Helper()
+
+		_, err := client.Export(context.Background(), request)
+		assert.NilError(t, err)
+
+		select {
+		case metrics := <-ch:
+			return metrics
+		case <-time.After(100 * time.Millisecond):
+			return nil
+		}
+	}
+
+	// the first cumulative point is only a baseline
+	assert.Assert(t, export(metricsRequest("frontend",
+		durationMetric("SPAN_KIND_SERVER", 10, 50, 1))) == nil)
+
+	// client spans and spans of unknown kind are not requests served
+	metrics := export(metricsRequest("frontend",
+		durationMetric("SPAN_KIND_SERVER", 14, 70, 1),
+		durationMetric("SPAN_KIND_CLIENT", 100, 1000, 1),
+		durationMetric("", 100, 1000, 1)))
+	assert.DeepEqual(t, metrics.Services, map[string]*receiver.ServiceMetrics{
+		"frontend": {Count: 4, DurationSum: 20e6},
+	})
+
+	// server metrics need no span kind
+	served := durationMetric("", 5, 5, 1)
+	served.Name = "http.server.request.duration"
+	served.Unit = "s"
+	served.GetHistogram().AggregationTemporality = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	metrics = export(metricsRequest("backend", served))
+	assert.DeepEqual(t, metrics.Services, map[string]*receiver.ServiceMetrics{
+		"backend": {Count: 5, DurationSum: 5e9},
+	})
+
+	// a new start time resets the series
+	metrics = export(metricsRequest("frontend", durationMetric("SPAN_KIND_SERVER", 3, 3, 2)))
+	assert.DeepEqual(t, metrics.Services, map[string]*receiver.ServiceMetrics{
+		"frontend": {Count: 3, DurationSum: 3e6},
+	})
+
+	metrics = export(metricsRequest("collector",
+		callsMetric("frontend", "backend", 7),
+		callsMetric("user", "frontend", 3)))
+	assert.DeepEqual(t, metrics.Calls, map[receiver.Edge]uint64{
+		{Client: "frontend", Server: "backend"}: 7,
+	})
+}
+
+func TestMetricsRetried(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan *receiver.Metrics, 1)
+	recv, conn := startReceiver(t, receiver.WithMetrics(ch), receiver.WithPolicy(receiver.PolicyDropNewest))
+	defer recv.Stop()
+	defer conn.Close()
+	client := colmetricspb.NewMetricsServiceClient(conn)
+
+	_, err := client.Export(context.Background(), metricsRequest("frontend",
+		durationMetric("SPAN_KIND_SERVER", 10, 50, 1)))
+	assert.NilError(t, err)
+
+	// the observer is not keeping up, so the retried point must still count
+	ch <- receiver.NewMetrics()
+	request := metricsRequest("frontend", durationMetric("SPAN_KIND_SERVER", 14, 70, 1))
+	_, err = client.Export(context.Background(), request)
+	assert.Equal(t, status.Code(err), codes.ResourceExhausted)
+	<-ch
+
+	_, err = client.Export(context.Background(), request)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, (<-ch).Services, map[string]*receiver.ServiceMetrics{
+		"frontend": {Count: 4, DurationSum: 20e6},
+	})
+}
@@ -1,52 +1,148 @@
 package receiver
 
 import (
+	"crypto/tls"
 	"net"
+	"sync/atomic"
+	"time"
 
+	"github.com/jaegertracing/jaeger-idl/proto-gen/api_v2"
+	"github.com/pako-23/queue-scaler/internal/forward"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
 	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
-const DefaultAddress = ":4317"
+const (
+	DefaultAddress     = ":4317"
+	DefaultRetryDelay  = time.Second
+	DefaultStopTimeout = 5 * time.Second
+
+	// DefaultMaxBodySize bounds the bodies accepted over HTTP, both as sent
+	// and once decompressed.
+	DefaultMaxBodySize = 16 << 20
+)
 
 type Span struct {
 	Duration    uint64
 	Parent      string
+	Pod         string
 	ServiceName string
 	SpanId      string
 	StartTime   uint64
 	TraceId     string
 }
 
+// Batch groups the spans delivered by a single export request by trace ID.
+type Batch map[string][]*Span
+
+func (b Batch) Add(span *Span) {
+	b[span.TraceId] = append(b[span.TraceId], span)
+}
+
+func (b Batch) Len() int {
+	count := 0
+	for _, spans := range b {
+		count += len(spans)
+	}
+
+	return count
+}
+
 type OTLPReceiver struct {
-	server  *grpc.Server
-	ch      chan<- *Span
-	address string
+	auth         *Authenticator
+	forwarders   []*forward.Forwarder
+	health       *health.Server
+	jaeger       bool
+	maxBodySize  int64
+	metrics      chan<- *Metrics
+	reflection   bool
+	server       *grpc.Server
+	ch           chan<- Batch
+	address      string
+	policy       Policy
+	rejected     *atomic.Uint64
+	retryDelay   time.Duration
+	stopTimeout  time.Duration
+	tlsConfig    *tls.Config
+	traces       *server
+	unauthorized *atomic.Uint64
 }
 
 type server struct {
 	coltracepb.UnimplementedTraceServiceServer
-	ch chan<- *Span
+	auth         *Authenticator
+	ch           chan<- Batch
+	forwarders   []*forward.Forwarder
+	maxBodySize  int64
+	policy       Policy
+	rejected     *atomic.Uint64
+	retryDelay   time.Duration
+	unauthorized *atomic.Uint64
 }
 
 type Option func(*OTLPReceiver)
 
 func NewOLTPReceiver(options ...Option) *OTLPReceiver {
 	receiver := &OTLPReceiver{
-		server:  grpc.NewServer(),
-		address: DefaultAddress,
+		address:      DefaultAddress,
+		maxBodySize:  DefaultMaxBodySize,
+		policy:       PolicyBlock,
+		rejected:     &atomic.Uint64{},
+		retryDelay:   DefaultRetryDelay,
+		stopTimeout:  DefaultStopTimeout,
+		unauthorized: &atomic.Uint64{},
 	}
 
 	for _, option := range options {
 		option(receiver)
 	}
 
-	coltracepb.RegisterTraceServiceServer(receiver.server, &server{ch: receiver.ch})
+	serverOptions := []grpc.ServerOption{}
+	if receiver.tlsConfig != nil {
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(receiver.tlsConfig)))
+	}
+	receiver.server = grpc.NewServer(serverOptions...)
+
+	receiver.traces = &server{
+		auth:         receiver.auth,
+		ch:           receiver.ch,
+		forwarders:   receiver.forwarders,
+		maxBodySize:  receiver.maxBodySize,
+		policy:       receiver.policy,
+		rejected:     receiver.rejected,
+		retryDelay:   receiver.retryDelay,
+		unauthorized: receiver.unauthorized,
+	}
+	coltracepb.RegisterTraceServiceServer(receiver.server, receiver.traces)
+	if receiver.jaeger {
+		api_v2.RegisterCollectorServiceServer(receiver.server, &jaegerServer{receiver.traces})
+	}
+	if receiver.metrics != nil {
+		colmetricspb.RegisterMetricsServiceServer(receiver.server, &metricsServer{
+			server: receiver.traces,
+			ch:     receiver.metrics,
+			series: newSeriesStore(),
+		})
+	}
+
+	receiver.health = health.NewServer()
+	receiver.SetServing(false)
+	healthpb.RegisterHealthServer(receiver.server, receiver.health)
+
+	if receiver.reflection {
+		reflection.Register(receiver.server)
+	}
+
 	return receiver
 }
 
-func WithChannel(ch chan<- *Span) Option {
+func WithChannel(ch chan<- Batch) Option {
 	return func(receiver *OTLPReceiver) {
 		receiver.ch = ch
 	}
@@ -58,6 +154,102 @@ func WithAddress(address string) Option {
 	}
 }
 
+func WithPolicy(policy Policy) Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.policy = policy
+	}
+}
+
+// WithMaxBodySize bounds the bodies accepted over HTTP to size bytes, both as
+// sent and once decompressed.
+func WithMaxBodySize(size int64) Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.maxBodySize = size
+	}
+}
+
+func WithRetryDelay(delay time.Duration) Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.retryDelay = delay
+	}
+}
+
+func WithTLS(config *tls.Config) Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.tlsConfig = config
+	}
+}
+
+func WithAuthenticator(auth *Authenticator) Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.auth = auth
+	}
+}
+
+// WithForwarder forwards every authenticated OTLP export request to the
+// forwarder's endpoint. It can be given more than once.
+func WithForwarder(forwarder *forward.Forwarder) Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.forwarders = append(receiver.forwarders, forwarder)
+	}
+}
+
+// WithMetrics accepts OTLP metrics on the gRPC server and sends the requests
+// they describe on ch.
+func WithMetrics(ch chan<- *Metrics) Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.metrics = ch
+	}
+}
+
+// WithJaeger also accepts Jaeger api_v2 batches on the gRPC server.
+func WithJaeger() Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.jaeger = true
+	}
+}
+
+func WithReflection() Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.reflection = true
+	}
+}
+
+func WithStopTimeout(timeout time.Duration) Option {
+	return func(receiver *OTLPReceiver) {
+		receiver.stopTimeout = timeout
+	}
+}
+
+// SetServing reports the receiver as ready, or not, through the gRPC health
+// service. Receivers start as not serving until something consumes their
+// spans.
+func (o *OTLPReceiver) SetServing(serving bool) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+
+	o.health.SetServingStatus("", status)
+	o.health.SetServingStatus(coltracepb.TraceService_ServiceDesc.ServiceName, status)
+	if o.jaeger {
+		o.health.SetServingStatus("jaeger.api_v2.CollectorService", status)
+	}
+	if o.metrics != nil {
+		o.health.SetServingStatus(colmetricspb.MetricsService_ServiceDesc.ServiceName, status)
+	}
+}
+
+// UnauthorizedSpans counts the spans rejected for their credentials. Zipkin
+// requests without valid credentials are rejected unread and not counted.
+func (o *OTLPReceiver) UnauthorizedSpans() uint64 {
+	return o.unauthorized.Load()
+}
+
+func (o *OTLPReceiver) RejectedSpans() uint64 {
+	return o.rejected.Load()
+}
+
 func (o *OTLPReceiver) Start() (net.Listener, <-chan error) {
 	ch := make(chan error, 1)
 
@@ -75,6 +267,21 @@ func (o *OTLPReceiver) Start() (net.Listener, <-chan error) {
 	return lis, ch
 }
 
+// Stop waits for the in-flight exports to complete for at most the stop
+// timeout before closing every connection.
 func (o *OTLPReceiver) Stop() {
-	o.server.Stop()
+	o.health.Shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		o.server.GracefulStop()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(o.stopTimeout):
+		o.server.Stop()
+		<-done
+	}
 }
@@ -19,7 +19,7 @@ func TestNewOLTPReceiver(t *testing.T) {
 	})
 
 	t.Run("construct with channel", func(t *testing.T) {
-		ch := make(chan *receiver.Span)
+		ch := make(chan receiver.Batch)
 		assert.Assert(t, receiver.NewOLTPReceiver(receiver.WithChannel(ch)) != nil)
 	})
 
@@ -28,7 +28,7 @@ func TestNewOLTPReceiver(t *testing.T) {
 	})
 
 	t.Run("construct with channel and address", func(t *testing.T) {
-		ch := make(chan *receiver.Span)
+		ch := make(chan receiver.Batch)
 		recv := receiver.NewOLTPReceiver(
 			receiver.WithChannel(ch),
 			receiver.WithAddress("127.0.0.0:130"))
@@ -47,6 +47,7 @@ func isListening(lis net.Listener) cmp.Comparison {
 		} else if conn == nil {
 			return cmp.ResultFailure(fmt.Sprintf("connection to %s failed", lis.Addr().String()))
 		}
+		conn.Close()
 
 		return cmp.ResultSuccess
 	}
@@ -81,7 +82,7 @@ func TestFailStart(t *testing.T) {
 	})
 
 	t.Run("with channel constructor", func(t *testing.T) {
-		ch := make(chan *receiver.Span)
+		ch := make(chan receiver.Batch)
 		checkError(receiver.NewOLTPReceiver(
 			receiver.WithChannel(ch),
 			receiver.WithAddress("127.0.0.1:1")))
@@ -0,0 +1,59 @@
+package receiver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// SnapshotPath is where queue-scaler instances running inside
+	// collectors publish their models.
+	SnapshotPath = "/snapshot"
+
+	// PublisherHeader names the instance publishing a snapshot, so that the
+	// latest snapshot of each can be kept. Instances that do not name
+	// themselves are told apart by address.
+	PublisherHeader = "X-Queue-Scaler-Publisher"
+)
+
+// SnapshotFunc accepts the JSON snapshot published by publisher, of which
+// only the services allows accepts may be used.
+type SnapshotFunc func(publisher string, allows func(service string) bool, snapshot json.RawMessage) error
+
+// SnapshotHandler returns an HTTP handler accepting published models on
+// SnapshotPath. Publishers go through the same authentication as OTLP.
+func (o *OTLPReceiver) SnapshotHandler(accept SnapshotFunc) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+SnapshotPath, func(w http.ResponseWriter, r *http.Request) {
+		o.traces.snapshot(w, r, accept)
+	})
+
+	return mux
+}
+
+func (s *server) snapshot(w http.ResponseWriter, r *http.Request, accept SnapshotFunc) {
+	grant, err := s.authenticate(requestContext(r))
+	if err != nil {
+		http.Error(w, status.Convert(err).Message(), http.StatusUnauthorized)
+		return
+	}
+
+	var snapshot json.RawMessage
+	if err := s.decodeBody(w, r, &snapshot); err != nil {
+		return
+	}
+
+	publisher := r.Header.Get(PublisherHeader)
+	if publisher == "" {
+		publisher, _, _ = net.SplitHostPort(r.RemoteAddr)
+	}
+
+	if err := accept(publisher, grant.allows, snapshot); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
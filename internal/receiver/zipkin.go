@@ -0,0 +1,194 @@
+package receiver
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ZipkinPath = "/api/v2/spans"
+
+	// SharedSpanSuffix is appended to the ID of the server side of a Zipkin
+	// span shared between a client and a server, so that both sides can be
+	// told apart. The server side becomes a child of the client side.
+	SharedSpanSuffix = ":shared"
+
+	zipkinTraceIdLength = 32
+)
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinSpan struct {
+	Duration      uint64            `json:"duration"`
+	Id            string            `json:"id"`
+	Kind          string            `json:"kind"`
+	LocalEndpoint *zipkinEndpoint   `json:"localEndpoint"`
+	ParentId      string            `json:"parentId"`
+	Shared        bool              `json:"shared"`
+	Tags          map[string]string `json:"tags"`
+	Timestamp     uint64            `json:"timestamp"`
+	TraceId       string            `json:"traceId"`
+}
+
+func (z *zipkinSpan) span() *Span {
+	span := &Span{
+		Duration:  z.Duration * 1000,
+		Parent:    strings.ToLower(z.ParentId),
+		Pod:       z.Tags[string(semconv.K8SPodNameKey)],
+		SpanId:    strings.ToLower(z.Id),
+		StartTime: z.Timestamp * 1000,
+		TraceId:   strings.ToLower(z.TraceId),
+	}
+
+	if z.LocalEndpoint != nil {
+		span.ServiceName = z.LocalEndpoint.ServiceName
+	}
+
+	if len(span.TraceId) < zipkinTraceIdLength {
+		span.TraceId = strings.Repeat("0", zipkinTraceIdLength-len(span.TraceId)) + span.TraceId
+	}
+
+	if z.Shared && z.Kind == "SERVER" {
+		span.Parent = span.SpanId
+		span.SpanId += SharedSpanSuffix
+	}
+
+	return span
+}
+
+// ZipkinHandler returns an HTTP handler accepting Zipkin v2 JSON spans on
+// ZipkinPath. Spans go through the same authentication and policy as OTLP.
+func (o *OTLPReceiver) ZipkinHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+ZipkinPath, o.traces.zipkin)
+
+	return mux
+}
+
+// requestContext carries the credentials of an HTTP request the way gRPC
+// metadata does, so that both are authenticated alike.
+func requestContext(r *http.Request) context.Context {
+	md := metadata.MD{}
+	if value := r.Header.Get(authorizationHeader); value != "" {
+		md.Set(authorizationHeader, value)
+	}
+	if value := r.Header.Get(apiKeyHeader); value != "" {
+		md.Set(apiKeyHeader, value)
+	}
+
+	return metadata.NewIncomingContext(r.Context(), md)
+}
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitedReader fails reads past its limit, unlike io.LimitReader which
+// would silently truncate the body.
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		if n, err := l.reader.Read(make([]byte, 1)); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, errBodyTooLarge
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+
+	return n, err
+}
+
+// decodeBody decodes the JSON body of r, possibly gzipped, into value. Bodies
+// larger than the limit of the server are rejected before and after
+// decompression. Failures are reported to w.
+func (s *server) decodeBody(w http.ResponseWriter, r *http.Request, value any) error {
+	body := io.Reader(http.MaxBytesReader(w, r.Body, s.maxBodySize))
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return err
+		}
+		defer reader.Close()
+		body = &limitedReader{reader: reader, remaining: s.maxBodySize}
+	}
+
+	err := json.NewDecoder(body).Decode(value)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, errBodyTooLarge) || errors.As(err, &maxBytesErr):
+		http.Error(w, errBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+
+	return err
+}
+
+func (s *server) zipkin(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil &&
+		mediaType != "application/json" {
+		http.Error(w, "only JSON spans are supported", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// bodies are only read from authenticated clients
+	ctx := requestContext(r)
+	grant, err := s.authenticate(ctx)
+	if err != nil {
+		http.Error(w, status.Convert(err).Message(), http.StatusUnauthorized)
+		return
+	}
+
+	var spans []zipkinSpan
+	if err := s.decodeBody(w, r, &spans); err != nil {
+		return
+	}
+
+	var denied int64
+	batch := Batch{}
+	for i := range spans {
+		span := spans[i].span()
+		if !grant.allows(span.ServiceName) {
+			denied++
+			continue
+		}
+		batch.Add(span)
+	}
+
+	_, _, err = s.deliver(ctx, batch, denied)
+	switch status.Code(err) {
+	case codes.OK:
+		w.WriteHeader(http.StatusAccepted)
+	case codes.PermissionDenied:
+		http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+	case codes.ResourceExhausted:
+		w.Header().Set("Retry-After",
+			strconv.Itoa(int(math.Ceil(s.retryDelay.Seconds()))))
+		http.Error(w, status.Convert(err).Message(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, status.Convert(err).Message(), http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,176 @@
+package receiver_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"gotest.tools/v3/assert"
+)
+
+const zipkinSpans = `[
+	{
+		"traceId": "463AC35C9F6413AD",
+		"id": "a2fb4a1d1a96d312",
+		"kind": "CLIENT",
+		"timestamp": 1000,
+		"duration": 300,
+		"localEndpoint": {"serviceName": "frontend"}
+	},
+	{
+		"traceId": "463ac35c9f6413ad",
+		"parentId": "a2fb4a1d1a96d312",
+		"id": "b7ad6b7169203331",
+		"kind": "SERVER",
+		"timestamp": 1100,
+		"duration": 150,
+		"localEndpoint": {"serviceName": "backend"}
+	},
+	{
+		"traceId": "463ac35c9f6413ad",
+		"id": "a2fb4a1d1a96d312",
+		"kind": "SERVER",
+		"shared": true,
+		"timestamp": 1050,
+		"duration": 200,
+		"localEndpoint": {"serviceName": "cart"},
+		"tags": {"k8s.pod.name": "cart-1"}
+	}
+]`
+
+func postZipkin(t *testing.T, handler http.Handler, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, receiver.ZipkinPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestZipkin(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan receiver.Batch, 1)
+	recv := receiver.NewOLTPReceiver(receiver.WithChannel(ch))
+
+	rec := postZipkin(t, recv.ZipkinHandler(), []byte(zipkinSpans), nil)
+	assert.Equal(t, rec.Code, http.StatusAccepted)
+
+	select {
+	case batch := <-ch:
+		spans := batch["0000000000000000463ac35c9f6413ad"]
+		assert.Equal(t, len(spans), 3)
+		assert.DeepEqual(t, *spans[0], receiver.Span{
+			Duration:    300000,
+			ServiceName: "frontend",
+			SpanId:      "a2fb4a1d1a96d312",
+			StartTime:   1000000,
+			TraceId:     "0000000000000000463ac35c9f6413ad",
+		})
+		assert.Equal(t, spans[1].Parent, "a2fb4a1d1a96d312")
+		assert.Equal(t, spans[1].ServiceName, "backend")
+		assert.Equal(t, spans[2].SpanId, "a2fb4a1d1a96d312"+receiver.SharedSpanSuffix)
+		assert.Equal(t, spans[2].Parent, "a2fb4a1d1a96d312")
+		assert.Equal(t, spans[2].Pod, "cart-1")
+	case <-time.After(time.Second):
+		t.Fatal("no batch received")
+	}
+}
+
+func TestZipkinGzip(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan receiver.Batch, 1)
+	recv := receiver.NewOLTPReceiver(receiver.WithChannel(ch))
+
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	_, err := writer.Write([]byte(zipkinSpans))
+	assert.NilError(t, err)
+	assert.NilError(t, writer.Close())
+
+	rec := postZipkin(t, recv.ZipkinHandler(), body.Bytes(),
+		map[string]string{"Content-Encoding": "gzip"})
+	assert.Equal(t, rec.Code, http.StatusAccepted)
+	assert.Equal(t, (<-ch).Len(), 3)
+}
+
+func TestZipkinErrors(t *testing.T) {
+	t.Parallel()
+
+	auth := receiver.NewAuthenticator(map[string]*receiver.Grant{
+		"frontend-token": {Services: []string{"frontend"}},
+	})
+	ch := make(chan receiver.Batch)
+	recv := receiver.NewOLTPReceiver(
+		receiver.WithAuthenticator(auth),
+		receiver.WithChannel(ch),
+		receiver.WithPolicy(receiver.PolicyDropNewest),
+		receiver.WithRetryDelay(1500*time.Millisecond))
+	handler := recv.ZipkinHandler()
+
+	// the body of unauthenticated requests is not read
+	rec := postZipkin(t, handler, []byte("{"), nil)
+	assert.Equal(t, rec.Code, http.StatusUnauthorized)
+
+	rec = postZipkin(t, handler, []byte("{"), map[string]string{"X-API-Key": "frontend-token"})
+	assert.Equal(t, rec.Code, http.StatusBadRequest)
+
+	rec = postZipkin(t, handler, []byte(zipkinSpans), nil)
+	assert.Equal(t, rec.Code, http.StatusUnauthorized)
+
+	rec = postZipkin(t, handler, []byte(`[{"traceId": "1", "id": "2", "localEndpoint": {"serviceName": "cart"}}]`),
+		map[string]string{"X-API-Key": "frontend-token"})
+	assert.Equal(t, rec.Code, http.StatusForbidden)
+
+	rec = postZipkin(t, handler, []byte(`[{"traceId": "1", "id": "2", "localEndpoint": {"serviceName": "frontend"}}]`),
+		map[string]string{"Authorization": "Bearer frontend-token"})
+	assert.Equal(t, rec.Code, http.StatusTooManyRequests)
+	assert.Equal(t, rec.Header().Get("Retry-After"), "2")
+	assert.Equal(t, recv.RejectedSpans(), uint64(1))
+	assert.Equal(t, recv.UnauthorizedSpans(), uint64(1))
+
+	req := httptest.NewRequest(http.MethodPost, receiver.ZipkinPath, bytes.NewReader([]byte{}))
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, rec.Code, http.StatusUnsupportedMediaType)
+}
+
+func TestZipkinBodyLimit(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan receiver.Batch, 1)
+	recv := receiver.NewOLTPReceiver(receiver.WithChannel(ch), receiver.WithMaxBodySize(4096))
+	handler := recv.ZipkinHandler()
+
+	rec := postZipkin(t, handler, []byte(zipkinSpans), nil)
+	assert.Equal(t, rec.Code, http.StatusAccepted)
+	assert.Equal(t, (<-ch).Len(), 3)
+
+	large := []byte("[" + strings.Repeat(" ", 1<<20) + "]")
+	rec = postZipkin(t, handler, large, nil)
+	assert.Equal(t, rec.Code, http.StatusRequestEntityTooLarge)
+
+	// a small body inflating past the limit
+	var body bytes.Buffer
+	writer := gzip.NewWriter(&body)
+	_, err := writer.Write(large)
+	assert.NilError(t, err)
+	assert.NilError(t, writer.Close())
+	assert.Assert(t, body.Len() < 4096)
+
+	rec = postZipkin(t, handler, body.Bytes(), map[string]string{"Content-Encoding": "gzip"})
+	assert.Equal(t, rec.Code, http.StatusRequestEntityTooLarge)
+}
@@ -0,0 +1,242 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+)
+
+type span struct {
+	Duration    uint64 `json:"duration"`
+	Parent      string `json:"parent,omitempty"`
+	Pod         string `json:"pod,omitempty"`
+	ServiceName string `json:"service,omitempty"`
+	SpanId      string `json:"spanId"`
+	StartTime   uint64 `json:"start"`
+	TraceId     string `json:"traceId"`
+}
+
+type call struct {
+	Client string `json:"client"`
+	Count  uint64 `json:"count"`
+	Server string `json:"server"`
+}
+
+type served struct {
+	Count       uint64 `json:"count"`
+	DurationSum uint64 `json:"durationSum"`
+}
+
+type metrics struct {
+	Calls    []call             `json:"calls,omitempty"`
+	Services map[string]*served `json:"services,omitempty"`
+}
+
+type queueLengths struct {
+	Lengths map[string]float64 `json:"lengths"`
+	MaxAge  int64              `json:"maxAge,omitempty"`
+}
+
+type snapshot struct {
+	MaxAge    int64           `json:"maxAge,omitempty"`
+	Publisher string          `json:"publisher"`
+	State     json.RawMessage `json:"state"`
+}
+
+type entry struct {
+	At           int64         `json:"at"`
+	Interval     int64         `json:"interval,omitempty"`
+	Metrics      *metrics      `json:"metrics,omitempty"`
+	QueueLengths *queueLengths `json:"queueLengths,omitempty"`
+	Snapshot     *snapshot     `json:"snapshot,omitempty"`
+	Span         *span         `json:"span,omitempty"`
+	Start        bool          `json:"start,omitempty"`
+}
+
+type Entry struct {
+	At       time.Time
+	Interval time.Duration
+	Metrics  *receiver.Metrics
+	// QueueLengths are the measured queue lengths, kept for QueueLengthAge,
+	// and empty when a measurement failed.
+	QueueLengths   map[string]float64
+	QueueLengthAge time.Duration
+	// Snapshot is the model published by Publisher, counting for SnapshotAge.
+	Publisher   string
+	Snapshot    json.RawMessage
+	SnapshotAge time.Duration
+	Span        *receiver.Span
+	Start       bool
+}
+
+func (e *Entry) Tick() bool {
+	return e.Span == nil && e.Metrics == nil && e.QueueLengths == nil && e.Snapshot == nil && !e.Start
+}
+
+// Writer records the inputs of a model. It may be shared by the observer and
+// the aggregator of published snapshots.
+type Writer struct {
+	encoder *json.Encoder
+	lock    sync.Mutex
+	writer  *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	writer := bufio.NewWriter(w)
+
+	return &Writer{
+		encoder: json.NewEncoder(writer),
+		writer:  writer,
+	}
+}
+
+func (w *Writer) RecordSpan(at time.Time, details *receiver.Span) error {
+	return w.encode(&entry{
+		At: at.UnixNano(),
+		Span: &span{
+			Duration:    details.Duration,
+			Parent:      details.Parent,
+			Pod:         details.Pod,
+			ServiceName: details.ServiceName,
+			SpanId:      details.SpanId,
+			StartTime:   details.StartTime,
+			TraceId:     details.TraceId,
+		},
+	})
+}
+
+// RecordMetrics records the requests reported through metrics, which are
+// added to the model next to the ones assembled from spans.
+func (w *Writer) RecordMetrics(at time.Time, details *receiver.Metrics) error {
+	recorded := &metrics{Services: make(map[string]*served, len(details.Services))}
+	for edge, count := range details.Calls {
+		recorded.Calls = append(recorded.Calls, call{Client: edge.Client, Count: count, Server: edge.Server})
+	}
+	sort.Slice(recorded.Calls, func(i, j int) bool {
+		if recorded.Calls[i].Client != recorded.Calls[j].Client {
+			return recorded.Calls[i].Client < recorded.Calls[j].Client
+		}
+		return recorded.Calls[i].Server < recorded.Calls[j].Server
+	})
+	for service, requests := range details.Services {
+		recorded.Services[service] = &served{Count: requests.Count, DurationSum: requests.DurationSum}
+	}
+
+	return w.encode(&entry{At: at.UnixNano(), Metrics: recorded})
+}
+
+// RecordQueueLengths records the queue lengths measured at the services,
+// which replace the previous ones and are forgotten after maxAge, if
+// positive.
+func (w *Writer) RecordQueueLengths(at time.Time, lengths map[string]float64, maxAge time.Duration) error {
+	recorded := &queueLengths{Lengths: lengths, MaxAge: int64(maxAge)}
+	if recorded.Lengths == nil {
+		recorded.Lengths = map[string]float64{}
+	}
+
+	return w.encode(&entry{At: at.UnixNano(), QueueLengths: recorded})
+}
+
+// RecordSnapshot records the model published by publisher, which counts for
+// maxAge.
+func (w *Writer) RecordSnapshot(at time.Time, publisher string, state json.RawMessage, maxAge time.Duration) error {
+	return w.encode(&entry{
+		At:       at.UnixNano(),
+		Snapshot: &snapshot{MaxAge: int64(maxAge), Publisher: publisher, State: state},
+	})
+}
+
+func (w *Writer) RecordStart(at time.Time) error {
+	return w.encode(&entry{
+		At:    at.UnixNano(),
+		Start: true,
+	})
+}
+
+func (w *Writer) RecordTick(at time.Time, interval time.Duration) error {
+	return w.encode(&entry{
+		At:       at.UnixNano(),
+		Interval: int64(interval),
+	})
+}
+
+func (w *Writer) encode(value *entry) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.encoder.Encode(value)
+}
+
+func (w *Writer) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.writer.Flush()
+}
+
+type Reader struct {
+	decoder *json.Decoder
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{decoder: json.NewDecoder(bufio.NewReader(r))}
+}
+
+func (r *Reader) Next() (*Entry, error) {
+	value := &entry{}
+	if err := r.decoder.Decode(value); err != nil {
+		return nil, err
+	}
+
+	next := &Entry{
+		At:       time.Unix(0, value.At),
+		Interval: time.Duration(value.Interval),
+		Start:    value.Start,
+	}
+
+	if value.Metrics != nil {
+		next.Metrics = receiver.NewMetrics()
+		for _, call := range value.Metrics.Calls {
+			next.Metrics.Calls[receiver.Edge{Client: call.Client, Server: call.Server}] += call.Count
+		}
+		for service, requests := range value.Metrics.Services {
+			next.Metrics.Services[service] = &receiver.ServiceMetrics{
+				Count:       requests.Count,
+				DurationSum: requests.DurationSum,
+			}
+		}
+	}
+
+	if value.QueueLengths != nil {
+		next.QueueLengths = value.QueueLengths.Lengths
+		if next.QueueLengths == nil {
+			next.QueueLengths = map[string]float64{}
+		}
+		next.QueueLengthAge = time.Duration(value.QueueLengths.MaxAge)
+	}
+
+	if value.Snapshot != nil {
+		next.Publisher = value.Snapshot.Publisher
+		next.Snapshot = value.Snapshot.State
+		next.SnapshotAge = time.Duration(value.Snapshot.MaxAge)
+	}
+
+	if value.Span != nil {
+		next.Span = &receiver.Span{
+			Duration:    value.Span.Duration,
+			Parent:      value.Span.Parent,
+			Pod:         value.Span.Pod,
+			ServiceName: value.Span.ServiceName,
+			SpanId:      value.Span.SpanId,
+			StartTime:   value.Span.StartTime,
+			TraceId:     value.Span.TraceId,
+		}
+	}
+
+	return next, nil
+}
@@ -0,0 +1,109 @@
+package record_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"github.com/pako-23/queue-scaler/internal/record"
+	"gotest.tools/v3/assert"
+)
+
+var testSpans = []*receiver.Span{
+	{
+		Duration:    100,
+		Parent:      "",
+		ServiceName: "service1",
+		SpanId:      "span1",
+		StartTime:   0,
+		TraceId:     "trace1",
+	},
+	{
+		Duration:    50,
+		Parent:      "span1",
+		ServiceName: "service2",
+		SpanId:      "span2",
+		StartTime:   10,
+		TraceId:     "trace1",
+	},
+	{
+		Duration:    50,
+		Parent:      "span1",
+		ServiceName: "",
+		SpanId:      "span3",
+		StartTime:   10,
+		TraceId:     "trace1",
+	},
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+
+	writer := record.NewWriter(&buffer)
+	start := time.Unix(1000, 0)
+	assert.NilError(t, writer.RecordStart(start))
+	for i, span := range testSpans {
+		assert.NilError(t, writer.RecordSpan(start.Add(time.Duration(i)*time.Millisecond), span))
+	}
+	metrics := receiver.NewMetrics()
+	metrics.Services["service3"] = &receiver.ServiceMetrics{Count: 10, DurationSum: 1e9}
+	metrics.Calls[receiver.Edge{Client: "service1", Server: "service3"}] = 5
+	metrics.Calls[receiver.Edge{Client: "service2", Server: "service3"}] = 2
+	assert.NilError(t, writer.RecordMetrics(start.Add(500*time.Millisecond), metrics))
+	assert.NilError(t, writer.RecordQueueLengths(start.Add(600*time.Millisecond), map[string]float64{"service1": 3}, time.Minute))
+	assert.NilError(t, writer.RecordQueueLengths(start.Add(700*time.Millisecond), nil, time.Minute))
+	assert.NilError(t, writer.RecordTick(start.Add(time.Second), 5*time.Second))
+	assert.NilError(t, writer.Flush())
+
+	reader := record.NewReader(&buffer)
+	next, err := reader.Next()
+	assert.NilError(t, err)
+	assert.Assert(t, next.Start)
+	assert.Assert(t, !next.Tick())
+	assert.Assert(t, next.At.Equal(start))
+
+	for i, span := range testSpans {
+		next, err := reader.Next()
+		assert.NilError(t, err)
+		assert.Assert(t, !next.Tick())
+		assert.Assert(t, next.At.Equal(start.Add(time.Duration(i)*time.Millisecond)))
+		assert.DeepEqual(t, span, next.Span)
+	}
+
+	next, err = reader.Next()
+	assert.NilError(t, err)
+	assert.Assert(t, !next.Tick())
+	assert.Assert(t, next.At.Equal(start.Add(500*time.Millisecond)))
+	assert.DeepEqual(t, metrics, next.Metrics)
+
+	// failed measurements clear the queue lengths
+	for _, lengths := range []map[string]float64{{"service1": 3}, {}} {
+		next, err = reader.Next()
+		assert.NilError(t, err)
+		assert.Assert(t, !next.Tick())
+		assert.DeepEqual(t, lengths, next.QueueLengths)
+		assert.Equal(t, time.Minute, next.QueueLengthAge)
+	}
+
+	next, err = reader.Next()
+	assert.NilError(t, err)
+	assert.Assert(t, next.Tick())
+	assert.Assert(t, next.At.Equal(start.Add(time.Second)))
+	assert.Equal(t, 5*time.Second, next.Interval)
+
+	_, err = reader.Next()
+	assert.Assert(t, errors.Is(err, io.EOF))
+}
+
+func TestReadInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := record.NewReader(strings.NewReader("{\"at\": \"now\"}")).Next()
+	assert.Assert(t, err != nil)
+}
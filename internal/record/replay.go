@@ -0,0 +1,134 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/clock"
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/observer"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+)
+
+// Replay feeds a recording to an observer. When models published by other
+// instances were recorded, they are merged into the model handed to the
+// controller on every tick, as they were live.
+func Replay(r *Reader, options ...observer.Option) (*observer.Observer, error) {
+	var (
+		aggregator     *controller.Aggregator
+		clk            *clock.Fake
+		queueLengthAge time.Duration
+	)
+
+	obs := observer.NewObserver(options...)
+	for {
+		next, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return obs, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if clk == nil {
+			clk = clock.NewFake(next.At)
+			obs = observer.NewObserver(append(options, observer.WithClock(clk))...)
+		}
+		clk.Set(next.At)
+
+		if next.Start {
+			obs.Start()
+		} else if next.Tick() {
+			// queue lengths expire on ticks, as they did live
+			if queueLengthAge > 0 {
+				obs.State.ExpireQueueLengths(next.At.Add(-queueLengthAge))
+			}
+			if err := obs.Tick(); err != nil {
+				log.Println(err)
+			}
+		} else if next.Metrics != nil {
+			obs.RecordMetrics(next.Metrics)
+		} else if next.QueueLengths != nil {
+			queueLengthAge = next.QueueLengthAge
+			obs.RecordQueueLengths(next.QueueLengths)
+		} else if next.Snapshot != nil {
+			if aggregator == nil {
+				aggregator = controller.NewAggregator(obs.Controller(),
+					controller.WithAggregatorClock(clk),
+					controller.WithMaxSnapshotAge(next.SnapshotAge))
+				observer.WithController(aggregator)(obs)
+			}
+
+			// the services not granted were left out when recording
+			if err := aggregator.Accept(next.Publisher, func(string) bool { return true }, next.Snapshot); err != nil {
+				return nil, err
+			}
+		} else {
+			obs.Record(next.Span)
+		}
+	}
+}
+
+// Stream replays the recording in real time. Consecutive spans recorded at
+// the same instant are delivered as a single batch.
+func Stream(ctx context.Context, r *Reader, ch chan<- receiver.Batch) error {
+	var (
+		offset    time.Duration
+		pending   receiver.Batch
+		pendingAt time.Time
+	)
+
+	flush := func() error {
+		if pending == nil {
+			return nil
+		}
+
+		select {
+		case <-time.After(time.Until(pendingAt.Add(offset))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		select {
+		case ch <- pending:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		pending = nil
+		return nil
+	}
+
+	started := false
+	for {
+		next, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return flush()
+		} else if err != nil {
+			return err
+		}
+
+		if !started {
+			offset = time.Since(next.At)
+			started = true
+		}
+
+		if next.Span == nil {
+			continue
+		}
+
+		if pending != nil && !next.At.Equal(pendingAt) {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		if pending == nil {
+			pending = receiver.Batch{}
+			pendingAt = next.At
+		}
+		pending.Add(next.Span)
+	}
+}
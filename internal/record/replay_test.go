@@ -0,0 +1,206 @@
+package record_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/clock"
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/observer"
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"github.com/pako-23/queue-scaler/internal/record"
+	"gotest.tools/v3/assert"
+)
+
+type tickController struct {
+	ticks chan struct{}
+}
+
+func (t *tickController) Stabilize(*queue.QueueNetwork) error {
+	t.ticks <- struct{}{}
+	return nil
+}
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+
+	writer := record.NewWriter(&buffer)
+	interval := 5 * time.Second
+	clk := clock.NewFake(time.Unix(1000, 0))
+	cont := &tickController{ticks: make(chan struct{})}
+	metrics := make(chan *receiver.Metrics)
+	queueLengths := make(chan map[string]float64)
+	live := observer.NewObserver(
+		observer.WithClock(clk),
+		observer.WithController(cont),
+		observer.WithInterval(interval),
+		observer.WithMetrics(metrics),
+		observer.WithQueueLengths(queueLengths, 8*time.Second),
+		observer.WithRecorder(writer))
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan receiver.Batch)
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			batch := receiver.Batch{}
+			for _, span := range testSpans {
+				copied := *span
+				copied.TraceId += strings.Repeat("x", i)
+				batch.Add(&copied)
+			}
+			ch <- batch
+
+			// requests known only through metrics
+			served := receiver.NewMetrics()
+			served.Services["service3"] = &receiver.ServiceMetrics{Count: uint64(10 * (i + 1)), DurationSum: 1e9}
+			served.Calls[receiver.Edge{Client: "service1", Server: "service3"}] = uint64(5 * (i + 1))
+			metrics <- served
+
+			// the measurement expires on the second tick
+			if i == 0 {
+				queueLengths <- map[string]float64{"service1": 3}
+			}
+
+			clk.Advance(interval + time.Duration(i)*time.Second)
+			<-cont.ticks
+		}
+		cancel()
+	}()
+
+	live.Observe(ctx, ch)
+	assert.NilError(t, writer.Flush())
+
+	replayed, err := record.Replay(record.NewReader(&buffer))
+	assert.NilError(t, err)
+
+	expected, err := json.Marshal(live.State)
+	assert.NilError(t, err)
+	value, err := json.Marshal(replayed.State)
+	assert.NilError(t, err)
+	assert.Equal(t, string(expected), string(value))
+	assert.Equal(t, live.State.ToDOT(), replayed.State.ToDOT())
+}
+
+func TestReplayEmpty(t *testing.T) {
+	t.Parallel()
+
+	obs, err := record.Replay(record.NewReader(strings.NewReader("")))
+	assert.NilError(t, err)
+	assert.Equal(t, "digraph {}", obs.State.ToDOT())
+}
+
+func TestReplayInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := record.Replay(record.NewReader(strings.NewReader("[]")))
+	assert.Assert(t, err != nil)
+}
+
+func TestStream(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+
+	writer := record.NewWriter(&buffer)
+	start := time.Now().Add(-time.Hour)
+	for i, span := range testSpans {
+		assert.NilError(t, writer.RecordSpan(start.Add(time.Duration(i)*20*time.Millisecond), span))
+	}
+	assert.NilError(t, writer.RecordTick(start.Add(time.Second), time.Second))
+	assert.NilError(t, writer.Flush())
+
+	ch := make(chan receiver.Batch, len(testSpans))
+	began := time.Now()
+	assert.NilError(t, record.Stream(context.Background(), record.NewReader(&buffer), ch))
+	assert.Assert(t, time.Since(began) >= 40*time.Millisecond)
+	assert.Assert(t, time.Since(began) < time.Second)
+
+	close(ch)
+	received := []*receiver.Span{}
+	for batch := range ch {
+		assert.Equal(t, 1, batch.Len())
+		for _, spans := range batch {
+			received = append(received, spans...)
+		}
+	}
+	assert.DeepEqual(t, testSpans, received)
+}
+
+func TestStreamCancel(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+
+	writer := record.NewWriter(&buffer)
+	assert.NilError(t, writer.RecordSpan(time.Now(), testSpans[0]))
+	assert.NilError(t, writer.RecordSpan(time.Now().Add(time.Hour), testSpans[1]))
+	assert.NilError(t, writer.Flush())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ch := make(chan receiver.Batch, 2)
+	err := record.Stream(ctx, record.NewReader(&buffer), ch)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, len(ch))
+}
+
+type statesController struct {
+	states []string
+}
+
+func (s *statesController) Stabilize(state *queue.QueueNetwork) error {
+	data, err := json.Marshal(state)
+	s.states = append(s.states, string(data))
+	return err
+}
+
+func TestReplaySnapshots(t *testing.T) {
+	t.Parallel()
+
+	var buffer bytes.Buffer
+
+	writer := record.NewWriter(&buffer)
+	clk := clock.NewFake(time.Unix(1000, 0))
+	live := &statesController{}
+	aggregator := controller.NewAggregator(live,
+		controller.WithAggregatorClock(clk),
+		controller.WithMaxSnapshotAge(8*time.Second),
+		controller.WithSnapshotRecorder(writer))
+	obs := observer.NewObserver(
+		observer.WithClock(clk),
+		observer.WithController(aggregator),
+		observer.WithRecorder(writer))
+	obs.Start()
+
+	published := queue.NewQueueNetwork()
+	for _, service := range []string{"backend", "frontend"} {
+		published.AddExternalRequest(&receiver.Span{Duration: 1000, ServiceName: service})
+	}
+	published.UpdateEstimates(time.Second)
+	snapshot, err := json.Marshal(published)
+	assert.NilError(t, err)
+	assert.NilError(t, aggregator.Accept("remote", func(service string) bool { return service == "frontend" }, snapshot))
+
+	// the snapshot expires on the second tick
+	for i := 0; i < 2; i++ {
+		obs.Record(testSpans[i])
+		clk.Advance(5 * time.Second)
+		assert.NilError(t, obs.Tick())
+	}
+	assert.NilError(t, writer.Flush())
+	assert.Assert(t, strings.Contains(live.states[0], "frontend"))
+	assert.Assert(t, !strings.Contains(live.states[1], "frontend"))
+
+	replayed := &statesController{}
+	_, err = record.Replay(record.NewReader(&buffer), observer.WithController(replayed))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, live.states, replayed.states)
+}
@@ -0,0 +1,86 @@
+package scrape
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultQuery = "sum by (service) (http_server_active_requests)"
+	DefaultLabel = "service"
+)
+
+// Prometheus measures queue lengths with an instant query against the HTTP
+// API of a Prometheus server. Every series of the result belongs to the
+// service named by its label.
+type Prometheus struct {
+	httpSource
+	address string
+	label   string
+	query   string
+}
+
+type queryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]any            `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+func NewPrometheus(address string, query string, label string, options ...Option) *Prometheus {
+	return &Prometheus{
+		httpSource: newHTTPSource(options),
+		address:    strings.TrimSuffix(address, "/"),
+		label:      label,
+		query:      query,
+	}
+}
+
+func (p *Prometheus) QueueLengths(ctx context.Context) (map[string]float64, error) {
+	resp, err := p.get(ctx, p.address+"/api/v1/query?query="+url.QueryEscape(p.query))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body queryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	if body.Status != "success" {
+		return nil, fmt.Errorf("query %q failed: %s", p.query, body.Error)
+	}
+	if body.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("query %q returned a %s, expected a vector", p.query, body.Data.ResultType)
+	}
+
+	lengths := map[string]float64{}
+	for _, series := range body.Data.Result {
+		service, ok := series.Metric[p.label]
+		if !ok {
+			continue
+		}
+
+		sample, ok := series.Value[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("query %q returned a malformed sample", p.query)
+		}
+		value, err := strconv.ParseFloat(sample, 64)
+		if err != nil {
+			return nil, err
+		}
+		lengths[service] += value
+	}
+
+	return lengths, nil
+}
@@ -0,0 +1,88 @@
+package scrape
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultInterval = 5 * time.Second
+	DefaultTimeout  = 5 * time.Second
+)
+
+// Source measures the number of requests each service is currently serving
+// or queueing.
+type Source interface {
+	QueueLengths(ctx context.Context) (map[string]float64, error)
+}
+
+type httpSource struct {
+	client *http.Client
+}
+
+type Option func(*httpSource)
+
+func newHTTPSource(options []Option) httpSource {
+	source := httpSource{client: &http.Client{Timeout: DefaultTimeout}}
+	for _, option := range options {
+		option(&source)
+	}
+
+	return source
+}
+
+func WithHTTPClient(client *http.Client) Option {
+	return func(source *httpSource) {
+		source.client = client
+	}
+}
+
+func (h *httpSource) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("scraping %s: %s", url, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// Run sends the queue lengths measured by source on ch every interval, until
+// ctx is done. Failed measurements are logged and sent empty, so that stale
+// lengths are not used.
+func Run(ctx context.Context, source Source, interval time.Duration, ch chan<- map[string]float64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			lengths, err := source.QueueLengths(ctx)
+			if err != nil {
+				log.Println(err)
+				lengths = map[string]float64{}
+			}
+
+			select {
+			case ch <- lengths:
+			case <-ctx.Done():
+				return
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package scrape_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/scrape"
+	"gotest.tools/v3/assert"
+)
+
+func TestPrometheus(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/api/v1/query")
+		assert.Equal(t, r.URL.Query().Get("query"), scrape.DefaultQuery)
+		io.WriteString(w, `{
+			"status": "success",
+			"data": {
+				"resultType": "vector",
+				"result": [
+					{"metric": {"service": "frontend"}, "value": [1700000000, "4"]},
+					{"metric": {"service": "backend"}, "value": [1700000000, "2.5"]},
+					{"metric": {}, "value": [1700000000, "9"]}
+				]
+			}
+		}`)
+	}))
+	defer server.Close()
+
+	source := scrape.NewPrometheus(server.URL+"/", scrape.DefaultQuery, scrape.DefaultLabel)
+	lengths, err := source.QueueLengths(context.Background())
+	assert.NilError(t, err)
+	assert.DeepEqual(t, lengths, map[string]float64{"frontend": 4, "backend": 2.5})
+}
+
+func TestPrometheusErrors(t *testing.T) {
+	t.Parallel()
+
+	responses := []string{
+		`{"status": "error", "error": "bad query"}`,
+		`{"status": "success", "data": {"resultType": "matrix", "result": []}}`,
+		`{"status": "success", "data": {"resultType": "vector", "result": [{"metric": {"service": "a"}, "value": [1, 2]}]}}`,
+		`not json`,
+	}
+
+	for _, response := range responses {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, response)
+		}))
+
+		_, err := scrape.NewPrometheus(server.URL, "up", "service").QueueLengths(context.Background())
+		assert.Assert(t, err != nil, response)
+		server.Close()
+	}
+}
+
+type stubSource map[string]float64
+
+func (s stubSource) QueueLengths(context.Context) (map[string]float64, error) {
+	return s, nil
+}
+
+type failingSource struct{}
+
+func (failingSource) QueueLengths(context.Context) (map[string]float64, error) {
+	return nil, errors.New("unreachable")
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		source   scrape.Source
+		expected map[string]float64
+	}{
+		{source: stubSource{"frontend": 7}, expected: map[string]float64{"frontend": 7}},
+		// failures clear the previous lengths
+		{source: failingSource{}, expected: map[string]float64{}},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := make(chan map[string]float64)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			scrape.Run(ctx, test.source, time.Millisecond, ch)
+		}()
+
+		assert.DeepEqual(t, <-ch, test.expected)
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,53 @@
+package simulator
+
+import "math/rand"
+
+type Distribution interface {
+	Mean() float64
+	Sample(rng *rand.Rand) float64
+}
+
+type Exponential struct {
+	Rate float64
+}
+
+func (e *Exponential) Mean() float64 {
+	if e.Rate == 0.0 {
+		return 0.0
+	}
+
+	return 1.0 / e.Rate
+}
+
+func (e *Exponential) Sample(rng *rand.Rand) float64 {
+	if e.Rate == 0.0 {
+		return 0.0
+	}
+
+	return rng.ExpFloat64() / e.Rate
+}
+
+type Empirical struct {
+	Samples []float64
+}
+
+func (e *Empirical) Mean() float64 {
+	if len(e.Samples) == 0 {
+		return 0.0
+	}
+
+	sum := 0.0
+	for _, sample := range e.Samples {
+		sum += sample
+	}
+
+	return sum / float64(len(e.Samples))
+}
+
+func (e *Empirical) Sample(rng *rand.Rand) float64 {
+	if len(e.Samples) == 0 {
+		return 0.0
+	}
+
+	return e.Samples[rng.Intn(len(e.Samples))]
+}
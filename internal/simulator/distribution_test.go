@@ -0,0 +1,34 @@
+package simulator_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/pako-23/queue-scaler/internal/simulator"
+	"gotest.tools/v3/assert"
+)
+
+func TestDistributionMean(t *testing.T) {
+	t.Parallel()
+
+	var tests = []struct {
+		distribution simulator.Distribution
+		expected     float64
+	}{
+		{distribution: &simulator.Exponential{Rate: 0.0}, expected: 0.0},
+		{distribution: &simulator.Exponential{Rate: 4.0}, expected: 0.25},
+		{distribution: &simulator.Empirical{}, expected: 0.0},
+		{distribution: &simulator.Empirical{Samples: []float64{1.0, 2.0, 6.0}}, expected: 3.0},
+	}
+
+	rng := rand.New(rand.NewSource(simulator.DefaultSeed))
+	for _, test := range tests {
+		assert.Assert(t, withinRelative(test.distribution.Mean(), test.expected, 10e-9))
+
+		sum := 0.0
+		for i := 0; i < 100000; i++ {
+			sum += test.distribution.Sample(rng)
+		}
+		assert.Assert(t, withinRelative(sum/100000, test.expected, 0.02))
+	}
+}
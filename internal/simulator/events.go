@@ -0,0 +1,47 @@
+package simulator
+
+const (
+	arrivalEvent = iota
+	departureEvent
+)
+
+type job struct {
+	arrival float64
+	parent  uint64
+	span    uint64
+	trace   uint64
+}
+
+type event struct {
+	time       float64
+	sequence   uint64
+	kind       int
+	generation uint64
+	node       string
+	job        *job
+}
+
+type eventQueue []*event
+
+func (e eventQueue) Len() int { return len(e) }
+
+func (e eventQueue) Less(i, j int) bool {
+	if e[i].time != e[j].time {
+		return e[i].time < e[j].time
+	}
+
+	return e[i].sequence < e[j].sequence
+}
+
+func (e eventQueue) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+
+func (e *eventQueue) Push(x any) { *e = append(*e, x.(*event)) }
+
+func (e *eventQueue) Pop() any {
+	old := *e
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*e = old[:len(old)-1]
+
+	return item
+}
@@ -0,0 +1,57 @@
+package simulator
+
+import (
+	"math"
+	"sort"
+)
+
+type NodeResult struct {
+	Completed      uint64
+	MeanLatency    float64
+	ReplicaSeconds float64
+	Utilization    float64
+	latencies      []float64
+}
+
+func newNodeResult(station *station) *NodeResult {
+	result := &NodeResult{
+		Completed:      station.completed,
+		MeanLatency:    0.0,
+		ReplicaSeconds: station.capacityTime,
+		Utilization:    0.0,
+		latencies:      make([]float64, len(station.latencies)),
+	}
+
+	copy(result.latencies, station.latencies)
+	sort.Float64s(result.latencies)
+
+	sum := 0.0
+	for _, latency := range result.latencies {
+		sum += latency
+	}
+
+	if len(result.latencies) > 0 {
+		result.MeanLatency = sum / float64(len(result.latencies))
+	}
+
+	if station.capacityTime > 0.0 {
+		result.Utilization = station.busyTime / station.capacityTime
+	}
+
+	return result
+}
+
+func (n *NodeResult) Percentile(percentile float64) float64 {
+	if len(n.latencies) == 0 {
+		return 0.0
+	}
+
+	rank := int(math.Ceil(percentile/100*float64(len(n.latencies)))) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(n.latencies) {
+		rank = len(n.latencies) - 1
+	}
+
+	return n.latencies[rank]
+}
@@ -0,0 +1,370 @@
+package simulator
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/queue"
+)
+
+const DefaultSeed int64 = 1
+
+type route struct {
+	calls float64
+	node  string
+}
+
+type station struct {
+	busy         int32
+	busyTime     float64
+	capacityTime float64
+	completed    uint64
+	lastUpdate   float64
+	latencies    []float64
+	replicas     int32
+	service      Distribution
+	waiting      []*job
+}
+
+func (s *station) advance(now float64) {
+	elapsed := now - s.lastUpdate
+	s.busyTime += float64(s.busy) * elapsed
+	s.capacityTime += float64(s.replicas) * elapsed
+	s.lastUpdate = now
+}
+
+type Visit struct {
+	Arrival   time.Duration
+	Departure time.Duration
+	Node      string
+	Parent    uint64
+	Span      uint64
+	Trace     uint64
+}
+
+type Request struct {
+	End   time.Duration
+	Entry string
+	Start time.Duration
+	Trace uint64
+}
+
+type request struct {
+	entry   string
+	pending int
+	start   float64
+}
+
+type Simulator struct {
+	arrivals       map[string]float64
+	clock          float64
+	events         eventQueue
+	generations    map[string]uint64
+	ids            uint64
+	nodes          []string
+	replicas       map[string]int32
+	requestHandler func(*Request)
+	requests       map[uint64]*request
+	rng            *rand.Rand
+	routes         map[string][]route
+	seed           int64
+	sequence       uint64
+	services       map[string]Distribution
+	stations       map[string]*station
+	visitHandler   func(*Visit)
+}
+
+type Option func(*Simulator)
+
+func NewSimulator(network *queue.QueueNetwork, options ...Option) *Simulator {
+	simulator := &Simulator{
+		arrivals:       network.ExternalRates(),
+		events:         eventQueue{},
+		generations:    map[string]uint64{},
+		replicas:       map[string]int32{},
+		requestHandler: func(*Request) {},
+		requests:       map[uint64]*request{},
+		routes:         map[string][]route{},
+		seed:           DefaultSeed,
+		services:       map[string]Distribution{},
+		stations:       map[string]*station{},
+		visitHandler:   func(*Visit) {},
+	}
+
+	for _, opt := range options {
+		opt(simulator)
+	}
+
+	simulator.rng = rand.New(rand.NewSource(simulator.seed))
+
+	for node, metric := range network.NodeMetrics {
+		simulator.nodes = append(simulator.nodes, node)
+
+		service, ok := simulator.services[node]
+		if !ok {
+			service = &Exponential{Rate: metric.ServiceRate()}
+		}
+
+		replicas, ok := simulator.replicas[node]
+		if !ok || replicas < 1 {
+			replicas = 1
+		}
+
+		simulator.stations[node] = &station{
+			latencies: []float64{},
+			replicas:  replicas,
+			service:   service,
+			waiting:   []*job{},
+		}
+	}
+	sort.Strings(simulator.nodes)
+
+	for from, probabilities := range network.RoutingProbabilities() {
+		routes := make([]route, 0, len(probabilities))
+		for to, calls := range probabilities {
+			routes = append(routes, route{calls: calls, node: to})
+		}
+		sort.Slice(routes, func(i, j int) bool { return routes[i].node < routes[j].node })
+		simulator.routes[from] = routes
+	}
+
+	for _, node := range simulator.nodes {
+		simulator.scheduleArrival(node)
+	}
+
+	return simulator
+}
+
+func WithSeed(seed int64) Option {
+	return func(simulator *Simulator) {
+		simulator.seed = seed
+	}
+}
+
+func WithReplicas(replicas map[string]int32) Option {
+	return func(simulator *Simulator) {
+		for node, count := range replicas {
+			simulator.replicas[node] = count
+		}
+	}
+}
+
+func WithServiceTime(node string, service Distribution) Option {
+	return func(simulator *Simulator) {
+		simulator.services[node] = service
+	}
+}
+
+func WithVisitHandler(handler func(*Visit)) Option {
+	return func(simulator *Simulator) {
+		simulator.visitHandler = handler
+	}
+}
+
+func WithRequestHandler(handler func(*Request)) Option {
+	return func(simulator *Simulator) {
+		simulator.requestHandler = handler
+	}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+func (s *Simulator) push(at float64, kind int, node string, job *job) {
+	s.sequence += 1
+	heap.Push(&s.events, &event{
+		time:       at,
+		sequence:   s.sequence,
+		kind:       kind,
+		generation: s.generations[node],
+		node:       node,
+		job:        job,
+	})
+}
+
+func (s *Simulator) nextId() uint64 {
+	s.ids += 1
+
+	return s.ids
+}
+
+func (s *Simulator) scheduleArrival(node string) {
+	rate := s.arrivals[node]
+	if rate <= 0.0 {
+		return
+	}
+
+	s.push(s.clock+s.rng.ExpFloat64()/rate, arrivalEvent, node, nil)
+}
+
+func (s *Simulator) startService(node string, job *job) {
+	station := s.stations[node]
+	station.advance(s.clock)
+	station.busy += 1
+	s.push(s.clock+station.service.Sample(s.rng), departureEvent, node, job)
+}
+
+func (s *Simulator) arrive(node string, job *job) {
+	s.requests[job.trace].pending += 1
+
+	station := s.stations[node]
+	if station.busy < station.replicas {
+		s.startService(node, job)
+	} else {
+		station.waiting = append(station.waiting, job)
+	}
+}
+
+func (s *Simulator) dispatch(node string) {
+	station := s.stations[node]
+	for len(station.waiting) > 0 && station.busy < station.replicas {
+		next := station.waiting[0]
+		station.waiting = station.waiting[1:]
+		s.startService(node, next)
+	}
+}
+
+func (s *Simulator) depart(node string, done *job) {
+	station := s.stations[node]
+	station.advance(s.clock)
+	station.busy -= 1
+	station.completed += 1
+	station.latencies = append(station.latencies, s.clock-done.arrival)
+	s.visitHandler(&Visit{
+		Arrival:   seconds(done.arrival),
+		Departure: seconds(s.clock),
+		Node:      node,
+		Parent:    done.parent,
+		Span:      done.span,
+		Trace:     done.trace,
+	})
+
+	for _, next := range s.routes[node] {
+		calls := int(math.Floor(next.calls))
+		if s.rng.Float64() < next.calls-float64(calls) {
+			calls += 1
+		}
+
+		for i := 0; i < calls; i++ {
+			s.arrive(next.node, &job{
+				arrival: s.clock,
+				parent:  done.span,
+				span:    s.nextId(),
+				trace:   done.trace,
+			})
+		}
+	}
+
+	s.dispatch(node)
+
+	origin := s.requests[done.trace]
+	origin.pending -= 1
+	if origin.pending == 0 {
+		delete(s.requests, done.trace)
+		s.requestHandler(&Request{
+			End:   seconds(s.clock),
+			Entry: origin.entry,
+			Start: seconds(origin.start),
+			Trace: done.trace,
+		})
+	}
+}
+
+func (s *Simulator) Now() time.Duration {
+	return seconds(s.clock)
+}
+
+func (s *Simulator) RunUntil(until time.Duration) {
+	end := until.Seconds()
+
+	for len(s.events) > 0 && s.events[0].time <= end {
+		next := heap.Pop(&s.events).(*event)
+		s.clock = next.time
+
+		switch next.kind {
+		case arrivalEvent:
+			if next.generation != s.generations[next.node] {
+				continue
+			}
+
+			trace := s.nextId()
+			s.requests[trace] = &request{entry: next.node, pending: 0, start: s.clock}
+			s.arrive(next.node, &job{
+				arrival: s.clock,
+				parent:  0,
+				span:    s.nextId(),
+				trace:   trace,
+			})
+			s.scheduleArrival(next.node)
+
+		case departureEvent:
+			s.depart(next.node, next.job)
+		}
+	}
+
+	if end > s.clock {
+		s.clock = end
+	}
+}
+
+func (s *Simulator) Run(duration time.Duration) {
+	s.RunUntil(s.Now() + duration)
+}
+
+func (s *Simulator) SetArrivalRate(node string, rate float64) {
+	if _, ok := s.stations[node]; !ok {
+		return
+	}
+
+	s.arrivals[node] = rate
+	s.generations[node] += 1
+	s.scheduleArrival(node)
+}
+
+func (s *Simulator) ArrivalRates() map[string]float64 {
+	rates := make(map[string]float64, len(s.arrivals))
+	for node, rate := range s.arrivals {
+		rates[node] = rate
+	}
+
+	return rates
+}
+
+func (s *Simulator) SetReplicas(node string, replicas int32) {
+	station, ok := s.stations[node]
+	if !ok {
+		return
+	}
+
+	if replicas < 1 {
+		replicas = 1
+	}
+
+	station.advance(s.clock)
+	station.replicas = replicas
+	s.dispatch(node)
+}
+
+func (s *Simulator) Replicas() map[string]int32 {
+	replicas := make(map[string]int32, len(s.stations))
+	for node, station := range s.stations {
+		replicas[node] = station.replicas
+	}
+
+	return replicas
+}
+
+func (s *Simulator) Results() map[string]*NodeResult {
+	results := make(map[string]*NodeResult, len(s.stations))
+
+	for node, station := range s.stations {
+		station.advance(s.clock)
+		results[node] = newNodeResult(station)
+	}
+
+	return results
+}
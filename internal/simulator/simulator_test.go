@@ -0,0 +1,137 @@
+package simulator_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"github.com/pako-23/queue-scaler/internal/simulator"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+const tandemNetwork = `{
+	"node1": {"durationSum": 500000000, "requestCount": 100, "incomingRate": 100, "totalRequests": 100},
+	"node2": {"callers": {"node1": 100}, "durationSum": 1000000000, "requestCount": 100}
+}`
+
+func loadNetwork(t *testing.T, snapshot string) *queue.QueueNetwork {
+	t.Helper()
+
+	network := queue.NewQueueNetwork()
+	assert.NilError(t, json.Unmarshal([]byte(snapshot), network))
+
+	return network
+}
+
+func withinRelative(value float64, expected float64, tolerance float64) cmp.Comparison {
+	return func() cmp.Result {
+		if math.Abs(value-expected) > tolerance*math.Abs(expected) {
+			return cmp.ResultFailure(
+				fmt.Sprintf("expected %f (±%.0f%%), but got %f", expected, tolerance*100, value))
+		}
+
+		return cmp.ResultSuccess
+	}
+}
+
+func TestSimulateSingleServer(t *testing.T) {
+	t.Parallel()
+
+	network := loadNetwork(t, `{
+		"node1": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 50, "totalRequests": 100}
+	}`)
+	sim := simulator.NewSimulator(network)
+	sim.Run(2000 * time.Second)
+
+	results := sim.Results()
+	assert.Equal(t, 1, len(results))
+	assert.Assert(t, withinRelative(results["node1"].Utilization, 0.5, 0.05))
+	assert.Assert(t, withinRelative(results["node1"].MeanLatency, 0.02, 0.05))
+	assert.Assert(t, withinRelative(results["node1"].Percentile(95), math.Log(20)/50, 0.05))
+}
+
+func TestSimulateMatchesAnalysis(t *testing.T) {
+	t.Parallel()
+
+	network := loadNetwork(t, tandemNetwork)
+	replicas := map[string]int32{"node1": 1, "node2": 2}
+	analysis := network.Analyze(replicas)
+
+	sim := simulator.NewSimulator(network, simulator.WithReplicas(replicas), simulator.WithSeed(42))
+	sim.Run(2000 * time.Second)
+
+	results := sim.Results()
+	for node, expected := range analysis.Nodes {
+		assert.Assert(t, withinRelative(float64(results[node].Completed)/2000, expected.ArrivalRate, 0.05))
+		assert.Assert(t, withinRelative(results[node].Utilization, expected.Utilization, 0.05))
+		assert.Assert(t, withinRelative(results[node].MeanLatency, expected.ResponseTime, 0.05))
+	}
+}
+
+func TestSimulateDeterministic(t *testing.T) {
+	t.Parallel()
+
+	run := func(seed int64) map[string]*simulator.NodeResult {
+		sim := simulator.NewSimulator(loadNetwork(t, tandemNetwork),
+			simulator.WithReplicas(map[string]int32{"node2": 2}),
+			simulator.WithSeed(seed))
+		sim.Run(100 * time.Second)
+
+		return sim.Results()
+	}
+
+	first, second, other := run(7), run(7), run(8)
+	for node := range first {
+		assert.Equal(t, first[node].Completed, second[node].Completed)
+		assert.Equal(t, first[node].MeanLatency, second[node].MeanLatency)
+		assert.Equal(t, first[node].Percentile(99), second[node].Percentile(99))
+		assert.Assert(t, first[node].MeanLatency != other[node].MeanLatency)
+	}
+}
+
+func TestSimulateEmpiricalServiceTime(t *testing.T) {
+	t.Parallel()
+
+	network := loadNetwork(t, `{
+		"node1": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 1, "totalRequests": 100}
+	}`)
+	sim := simulator.NewSimulator(network,
+		simulator.WithServiceTime("node1", &simulator.Empirical{Samples: []float64{0.001, 0.003}}))
+	sim.Run(1000 * time.Second)
+
+	result := sim.Results()["node1"]
+	assert.Assert(t, result.Completed > 0)
+	assert.Assert(t, result.Percentile(0) > 0.0009)
+	assert.Assert(t, result.Percentile(100) < 0.01)
+	assert.Assert(t, withinRelative(result.Utilization, 0.002, 0.1))
+}
+
+func TestSimulateSetReplicas(t *testing.T) {
+	t.Parallel()
+
+	network := loadNetwork(t, `{
+		"node1": {"durationSum": 1000000000, "requestCount": 100, "incomingRate": 150, "totalRequests": 100}
+	}`)
+	sim := simulator.NewSimulator(network)
+	sim.Run(10 * time.Second)
+	assert.Assert(t, sim.Results()["node1"].Utilization > 0.99)
+
+	sim.SetReplicas("node1", 4)
+	assert.Equal(t, int32(4), sim.Replicas()["node1"])
+	assert.Equal(t, 10*time.Second, sim.Now())
+	sim.Run(2000 * time.Second)
+	assert.Assert(t, sim.Results()["node1"].Utilization < 0.45)
+}
+
+func TestSimulateEmptyNetwork(t *testing.T) {
+	t.Parallel()
+
+	sim := simulator.NewSimulator(queue.NewQueueNetwork())
+	sim.Run(time.Second)
+	assert.Equal(t, 0, len(sim.Results()))
+	assert.Equal(t, time.Second, sim.Now())
+}
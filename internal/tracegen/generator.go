@@ -0,0 +1,184 @@
+package tracegen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/simulator"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+type Span struct {
+	Service string
+	Span    *tracepb.Span
+}
+
+type Generator struct {
+	deferred      []*Span
+	distributions map[string]simulator.Distribution
+	dropParent    float64
+	entries       []string
+	reorder       float64
+	rng           *rand.Rand
+	seed          int64
+	topology      *Topology
+}
+
+type Option func(*Generator)
+
+func NewGenerator(topology *Topology, options ...Option) (*Generator, error) {
+	generator := &Generator{
+		deferred:      []*Span{},
+		distributions: make(map[string]simulator.Distribution, len(topology.Services)),
+		entries:       topology.entrypoints(),
+		seed:          simulator.DefaultSeed,
+		topology:      topology,
+	}
+
+	for _, opt := range options {
+		opt(generator)
+	}
+
+	generator.rng = rand.New(rand.NewSource(generator.seed))
+	for name, service := range topology.Services {
+		if service == nil {
+			return nil, fmt.Errorf("%w: '%s'", errMissingService, name)
+		}
+
+		distribution, err := service.ServiceTime.Distribution()
+		if err != nil {
+			return nil, fmt.Errorf("service '%s': %w", name, err)
+		}
+		generator.distributions[name] = distribution
+	}
+
+	return generator, nil
+}
+
+func WithSeed(seed int64) Option {
+	return func(generator *Generator) {
+		generator.seed = seed
+	}
+}
+
+func WithReorder(probability float64) Option {
+	return func(generator *Generator) {
+		generator.reorder = probability
+	}
+}
+
+func WithDropParent(probability float64) Option {
+	return func(generator *Generator) {
+		generator.dropParent = probability
+	}
+}
+
+func (g *Generator) id(size int) []byte {
+	id := make([]byte, size)
+	for i := 0; i < size; i += 8 {
+		binary.BigEndian.PutUint64(id[i:], g.rng.Uint64())
+	}
+
+	return id
+}
+
+func (g *Generator) entry() string {
+	target := g.rng.Float64() * g.topology.ArrivalRate()
+	for _, entry := range g.entries {
+		target -= g.topology.Entrypoints[entry]
+		if target < 0 {
+			return entry
+		}
+	}
+
+	return g.entries[len(g.entries)-1]
+}
+
+func (g *Generator) call(service string, traceId []byte, parent []byte, start time.Time, spans []*Span) (time.Time, []*Span) {
+	span := &tracepb.Span{
+		TraceId:           traceId,
+		SpanId:            g.id(8),
+		ParentSpanId:      parent,
+		Name:              service,
+		Kind:              tracepb.Span_SPAN_KIND_SERVER,
+		StartTimeUnixNano: uint64(start.UnixNano()),
+	}
+	spans = append(spans, &Span{Service: service, Span: span})
+
+	end := start.Add(time.Duration(g.distributions[service].Sample(g.rng) * float64(time.Second)))
+	for _, call := range g.topology.Services[service].Calls {
+		if g.rng.Float64() < call.Probability {
+			end, spans = g.call(call.Service, traceId, span.SpanId, end, spans)
+		}
+	}
+	span.EndTimeUnixNano = uint64(end.UnixNano())
+
+	return end, spans
+}
+
+func (g *Generator) Trace(start time.Time) []*Span {
+	_, spans := g.call(g.entry(), g.id(16), nil, start, []*Span{})
+
+	return spans
+}
+
+func (g *Generator) Next(start time.Time) []*Span {
+	spans := g.deferred
+	g.deferred = []*Span{}
+
+	for _, span := range g.Trace(start) {
+		if len(span.Span.ParentSpanId) == 0 && g.rng.Float64() < g.dropParent {
+			continue
+		} else if g.rng.Float64() < g.reorder {
+			g.deferred = append(g.deferred, span)
+			continue
+		}
+
+		spans = append(spans, span)
+	}
+
+	return spans
+}
+
+func serviceResource(service string) *resourcepb.Resource {
+	return &resourcepb.Resource{
+		Attributes: []*commonpb.KeyValue{{
+			Key: string(semconv.ServiceNameKey),
+			Value: &commonpb.AnyValue{
+				Value: &commonpb.AnyValue_StringValue{StringValue: service},
+			},
+		}},
+	}
+}
+
+func Request(spans []*Span) *coltracepb.ExportTraceServiceRequest {
+	grouped := map[string][]*tracepb.Span{}
+	for _, span := range spans {
+		grouped[span.Service] = append(grouped[span.Service], span.Span)
+	}
+
+	services := make([]string, 0, len(grouped))
+	for service := range grouped {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	request := &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: make([]*tracepb.ResourceSpans, 0, len(services)),
+	}
+	for _, service := range services {
+		request.ResourceSpans = append(request.ResourceSpans, &tracepb.ResourceSpans{
+			Resource:   serviceResource(service),
+			ScopeSpans: []*tracepb.ScopeSpans{{Spans: grouped[service]}},
+		})
+	}
+
+	return request
+}
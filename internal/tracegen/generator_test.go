@@ -0,0 +1,128 @@
+package tracegen_test
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/tracegen"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func loadTestTopology(t *testing.T) *tracegen.Topology {
+	t.Helper()
+
+	topology, err := tracegen.LoadTopology(writeTopology(t, testTopology))
+	assert.NilError(t, err)
+
+	return topology
+}
+
+func newGenerator(t *testing.T, topology *tracegen.Topology, options ...tracegen.Option) *tracegen.Generator {
+	t.Helper()
+
+	generator, err := tracegen.NewGenerator(topology, options...)
+	assert.NilError(t, err)
+
+	return generator
+}
+
+func TestNewGeneratorInvalidServiceTime(t *testing.T) {
+	t.Parallel()
+
+	_, err := tracegen.NewGenerator(&tracegen.Topology{
+		Entrypoints: map[string]float64{"a": 1},
+		Services:    map[string]*tracegen.Service{"a": {ServiceTime: tracegen.ServiceTime{Type: "pareto"}}},
+	})
+	assert.Assert(t, err != nil)
+
+	_, err = tracegen.NewGenerator(&tracegen.Topology{
+		Entrypoints: map[string]float64{"a": 1},
+		Services:    map[string]*tracegen.Service{"a": nil},
+	})
+	assert.Assert(t, err != nil)
+}
+
+func TestGenerateTrace(t *testing.T) {
+	t.Parallel()
+
+	generator := newGenerator(t, loadTestTopology(t))
+	start := time.Unix(1000, 0)
+
+	for i := 0; i < 100; i++ {
+		spans := generator.Trace(start)
+		assert.Assert(t, len(spans) >= 2)
+
+		root := spans[0].Span
+		assert.Equal(t, 0, len(root.ParentSpanId))
+		assert.Equal(t, uint64(start.UnixNano()), root.StartTimeUnixNano)
+
+		ids := map[string]bool{}
+		for _, span := range spans {
+			assert.DeepEqual(t, root.TraceId, span.Span.TraceId)
+			assert.Assert(t, span.Span.EndTimeUnixNano > span.Span.StartTimeUnixNano)
+			assert.Assert(t, span.Span.EndTimeUnixNano <= root.EndTimeUnixNano)
+			if len(span.Span.ParentSpanId) > 0 {
+				assert.Assert(t, ids[hex.EncodeToString(span.Span.ParentSpanId)])
+			}
+			ids[hex.EncodeToString(span.Span.SpanId)] = true
+		}
+		assert.Equal(t, "db", spans[len(spans)-1].Service)
+	}
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	t.Parallel()
+
+	first := newGenerator(t, loadTestTopology(t), tracegen.WithSeed(5))
+	second := newGenerator(t, loadTestTopology(t), tracegen.WithSeed(5))
+	start := time.Unix(1000, 0)
+
+	for i := 0; i < 10; i++ {
+		assert.Assert(t, proto.Equal(
+			tracegen.Request(first.Next(start)), tracegen.Request(second.Next(start))))
+	}
+}
+
+func TestGenerateDropParent(t *testing.T) {
+	t.Parallel()
+
+	generator := newGenerator(t, loadTestTopology(t), tracegen.WithDropParent(1.0))
+	for i := 0; i < 10; i++ {
+		for _, span := range generator.Next(time.Now()) {
+			assert.Assert(t, len(span.Span.ParentSpanId) > 0)
+		}
+	}
+}
+
+func TestGenerateReorder(t *testing.T) {
+	t.Parallel()
+
+	generator := newGenerator(t, loadTestTopology(t), tracegen.WithReorder(1.0))
+	first := generator.Next(time.Now())
+	assert.Equal(t, 0, len(first))
+
+	second := generator.Next(time.Now())
+	assert.Assert(t, len(second) >= 2)
+	assert.Equal(t, 0, len(second[0].Span.ParentSpanId))
+}
+
+func TestRequest(t *testing.T) {
+	t.Parallel()
+
+	generator := newGenerator(t, loadTestTopology(t))
+	spans := generator.Trace(time.Now())
+	request := tracegen.Request(spans)
+
+	total := 0
+	previous := ""
+	for _, resourceSpans := range request.ResourceSpans {
+		attribute := resourceSpans.Resource.Attributes[0]
+		assert.Equal(t, "service.name", attribute.Key)
+		assert.Assert(t, attribute.Value.GetStringValue() > previous)
+		previous = attribute.Value.GetStringValue()
+		total += len(resourceSpans.ScopeSpans[0].Spans)
+	}
+	assert.Equal(t, len(spans), total)
+}
@@ -0,0 +1,195 @@
+package tracegen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/pako-23/queue-scaler/internal/simulator"
+)
+
+var (
+	errNoEntrypoints       = errors.New("the topology has no entrypoints")
+	errUnknownService      = errors.New("unknown service")
+	errInvalidRate         = errors.New("arrival rates must be positive")
+	errInvalidCall         = errors.New("call probabilities must be between 0 and 1")
+	errCyclicTopology      = errors.New("the topology contains a cycle")
+	errUnknownDistribution = errors.New("unknown service time distribution")
+	errInvalidServiceTime  = errors.New("service times must be positive")
+	errMissingService      = errors.New("the service has no definition")
+)
+
+type Call struct {
+	Probability float64 `json:"probability"`
+	Service     string  `json:"service"`
+}
+
+type ServiceTime struct {
+	Mean    float64   `json:"mean"`
+	Samples []float64 `json:"samples"`
+	Type    string    `json:"type"`
+}
+
+type Service struct {
+	Calls       []Call      `json:"calls"`
+	ServiceTime ServiceTime `json:"serviceTime"`
+}
+
+type Topology struct {
+	Entrypoints map[string]float64  `json:"entrypoints"`
+	Services    map[string]*Service `json:"services"`
+}
+
+func LoadTopology(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	topology := &Topology{}
+	if err := json.Unmarshal(data, topology); err != nil {
+		return nil, err
+	}
+
+	if err := topology.Validate(); err != nil {
+		return nil, err
+	}
+
+	return topology, nil
+}
+
+func (s *ServiceTime) Distribution() (simulator.Distribution, error) {
+	switch s.Type {
+	case "", "exponential":
+		if s.Mean <= 0.0 {
+			return nil, errInvalidServiceTime
+		}
+		return &simulator.Exponential{Rate: 1 / s.Mean}, nil
+
+	case "constant":
+		if s.Mean <= 0.0 {
+			return nil, errInvalidServiceTime
+		}
+		return &simulator.Empirical{Samples: []float64{s.Mean}}, nil
+
+	case "empirical":
+		if len(s.Samples) == 0 {
+			return nil, errInvalidServiceTime
+		}
+		for _, sample := range s.Samples {
+			if sample <= 0.0 {
+				return nil, errInvalidServiceTime
+			}
+		}
+		return &simulator.Empirical{Samples: s.Samples}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: '%s'", errUnknownDistribution, s.Type)
+	}
+}
+
+func (t *Topology) visit(service string, visiting map[string]bool, visited map[string]bool) error {
+	if visiting[service] {
+		return errCyclicTopology
+	} else if visited[service] {
+		return nil
+	}
+
+	visiting[service] = true
+	for _, call := range t.Services[service].Calls {
+		if _, ok := t.Services[call.Service]; !ok {
+			return fmt.Errorf("%w: '%s'", errUnknownService, call.Service)
+		} else if call.Probability < 0.0 || call.Probability > 1.0 {
+			return errInvalidCall
+		}
+
+		if err := t.visit(call.Service, visiting, visited); err != nil {
+			return err
+		}
+	}
+	visiting[service] = false
+	visited[service] = true
+
+	return nil
+}
+
+func (t *Topology) Validate() error {
+	if len(t.Entrypoints) == 0 {
+		return errNoEntrypoints
+	}
+
+	for entry, rate := range t.Entrypoints {
+		if _, ok := t.Services[entry]; !ok {
+			return fmt.Errorf("%w: '%s'", errUnknownService, entry)
+		} else if rate <= 0.0 {
+			return errInvalidRate
+		}
+	}
+
+	names := make([]string, 0, len(t.Services))
+	for name, service := range t.Services {
+		if service == nil {
+			return fmt.Errorf("%w: '%s'", errMissingService, name)
+		} else if _, err := service.ServiceTime.Distribution(); err != nil {
+			return fmt.Errorf("service '%s': %w", name, err)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// services not reached yet are checked as well
+	visited := make(map[string]bool, len(t.Services))
+	for _, name := range names {
+		if err := t.visit(name, map[string]bool{}, visited); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *Topology) entrypoints() []string {
+	entries := make([]string, 0, len(t.Entrypoints))
+	for entry := range t.Entrypoints {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+
+	return entries
+}
+
+func (t *Topology) ArrivalRate() float64 {
+	rate := 0.0
+	for _, value := range t.Entrypoints {
+		rate += value
+	}
+
+	return rate
+}
+
+func (t *Topology) spans(service string, expected map[string]float64) float64 {
+	if value, ok := expected[service]; ok {
+		return value
+	}
+
+	value := 1.0
+	for _, call := range t.Services[service].Calls {
+		value += call.Probability * t.spans(call.Service, expected)
+	}
+	expected[service] = value
+
+	return value
+}
+
+func (t *Topology) ExpectedSpans() float64 {
+	expected := make(map[string]float64, len(t.Services))
+	spans := 0.0
+
+	for entry, rate := range t.Entrypoints {
+		spans += rate / t.ArrivalRate() * t.spans(entry, expected)
+	}
+
+	return spans
+}
@@ -0,0 +1,92 @@
+package tracegen_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pako-23/queue-scaler/internal/tracegen"
+	"gotest.tools/v3/assert"
+)
+
+const testTopology = `{
+	"entrypoints": {"frontend": 40, "admin": 10},
+	"services": {
+		"frontend": {
+			"serviceTime": {"type": "exponential", "mean": 0.005},
+			"calls": [
+				{"service": "cart", "probability": 0.5},
+				{"service": "db", "probability": 1.0}
+			]
+		},
+		"admin": {
+			"serviceTime": {"type": "constant", "mean": 0.002},
+			"calls": [{"service": "db", "probability": 1.0}]
+		},
+		"cart": {
+			"serviceTime": {"type": "empirical", "samples": [0.001, 0.002]},
+			"calls": [{"service": "db", "probability": 1.0}]
+		},
+		"db": {"serviceTime": {"mean": 0.001}}
+	}
+}`
+
+func writeTopology(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "topology.json")
+	assert.NilError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestLoadTopology(t *testing.T) {
+	t.Parallel()
+
+	topology, err := tracegen.LoadTopology(writeTopology(t, testTopology))
+	assert.NilError(t, err)
+	assert.Equal(t, 4, len(topology.Services))
+	assert.Equal(t, 50.0, topology.ArrivalRate())
+	assert.Assert(t, math.Abs(topology.ExpectedSpans()-2.8) < 10e-9)
+}
+
+func TestLoadTopologyErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := tracegen.LoadTopology(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Assert(t, err != nil)
+
+	var tests = []string{
+		`{`,
+		`{"services": {"a": {"serviceTime": {"mean": 1}}}}`,
+		`{"entrypoints": {"b": 1}, "services": {"a": {"serviceTime": {"mean": 1}}}}`,
+		`{"entrypoints": {"a": 0}, "services": {"a": {"serviceTime": {"mean": 1}}}}`,
+		`{"entrypoints": {"a": 1}, "services": {"a": {"serviceTime": {"mean": 0}}}}`,
+		`{"entrypoints": {"a": 1}, "services": {"a": {"serviceTime": {"type": "constant"}}}}`,
+		`{"entrypoints": {"a": 1}, "services": {"a": {"serviceTime": {"type": "empirical"}}}}`,
+		`{"entrypoints": {"a": 1}, "services": {"a": {"serviceTime": {"type": "empirical", "samples": [-1]}}}}`,
+		`{"entrypoints": {"a": 1}, "services": {"a": {"serviceTime": {"type": "pareto", "mean": 1}}}}`,
+		`{"entrypoints": {"a": 1}, "services": {"a": {"serviceTime": {"mean": 1}, "calls": [{"service": "b", "probability": 1}]}}}`,
+		`{"entrypoints": {"a": 1}, "services": {
+			"a": {"serviceTime": {"mean": 1}, "calls": [{"service": "b", "probability": 2}]},
+			"b": {"serviceTime": {"mean": 1}}}}`,
+		`{"entrypoints": {"a": 1}, "services": {
+			"a": {"serviceTime": {"mean": 1}, "calls": [{"service": "b", "probability": 1}]},
+			"b": {"serviceTime": {"mean": 1}, "calls": [{"service": "a", "probability": 1}]}}}`,
+		`{"entrypoints": {"a": 1}, "services": {"a": {"serviceTime": {"mean": 1}}, "b": null}}`,
+		// services no entry point reaches yet
+		`{"entrypoints": {"a": 1}, "services": {
+			"a": {"serviceTime": {"mean": 1}},
+			"b": {"serviceTime": {"mean": 1}, "calls": [{"service": "c", "probability": 1}]}}}`,
+		`{"entrypoints": {"a": 1}, "services": {
+			"a": {"serviceTime": {"mean": 1}},
+			"b": {"serviceTime": {"mean": 1}, "calls": [{"service": "c", "probability": 1}]},
+			"c": {"serviceTime": {"mean": 1}, "calls": [{"service": "b", "probability": 1}]}}}`,
+	}
+
+	for _, test := range tests {
+		_, err := tracegen.LoadTopology(writeTopology(t, test))
+		assert.Assert(t, err != nil, "expected topology %s to be rejected", test)
+	}
+}
@@ -0,0 +1,219 @@
+// Package scaler runs the queue-scaler trace analysis inside another process,
+// such as an OpenTelemetry Collector traces exporter. Spans are handed over
+// as ptrace.Traces instead of being received over OTLP.
+//
+// A Collector exporter wraps an Exporter by passing ConsumeTraces as the push
+// function and Start and Shutdown as the component lifecycle hooks.
+package scaler
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pako-23/queue-scaler/internal/controller"
+	"github.com/pako-23/queue-scaler/internal/observer"
+	"github.com/pako-23/queue-scaler/internal/queue"
+	"github.com/pako-23/queue-scaler/internal/receiver"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+)
+
+const DefaultBufferSize = 1024
+
+var (
+	ErrNotStarted = errors.New("exporter not started")
+	ErrStarted    = errors.New("exporter already started")
+)
+
+type (
+	Controller      = controller.Controller
+	PublisherOption = controller.PublisherOption
+	QueueNetwork    = queue.QueueNetwork
+)
+
+var (
+	// WithHTTPClient publishes with client, such as one trusting the CA of
+	// the controller process.
+	WithHTTPClient = controller.WithHTTPClient
+	// WithPublisherName tells the snapshots of this exporter apart from the
+	// ones of other collectors, the host name by default.
+	WithPublisherName = controller.WithPublisherName
+	// WithToken authenticates the exporter with one of the tokens of the
+	// controller process.
+	WithToken = controller.WithToken
+)
+
+// Exporter assembles traces into a queue network model and periodically
+// hands it to its controllers.
+type Exporter struct {
+	bufferSize  int
+	cancel      context.CancelFunc
+	ch          chan receiver.Batch
+	controllers []controller.CompositeOption
+	done        chan struct{}
+	lock        sync.RWMutex
+	options     []observer.Option
+}
+
+type Option func(*Exporter)
+
+func NewExporter(options ...Option) *Exporter {
+	exporter := &Exporter{bufferSize: DefaultBufferSize}
+
+	for _, option := range options {
+		option(exporter)
+	}
+
+	return exporter
+}
+
+// WithController adds a controller receiving every model. It can be given
+// more than once.
+func WithController(name string, cont Controller) Option {
+	return func(exporter *Exporter) {
+		exporter.controllers = append(exporter.controllers,
+			controller.WithNamedController(name, cont))
+	}
+}
+
+// WithPublisher sends every model to the snapshot endpoint of a queue-scaler
+// controller process, such as https://queue-scaler:9412/snapshot when it runs
+// with -snapshot-address :9412.
+func WithPublisher(url string, options ...PublisherOption) Option {
+	return WithController("publisher", controller.NewPublisher(url, options...))
+}
+
+func WithInterval(interval time.Duration) Option {
+	return func(exporter *Exporter) {
+		exporter.options = append(exporter.options, observer.WithInterval(interval))
+	}
+}
+
+func WithShards(shards int) Option {
+	return func(exporter *Exporter) {
+		exporter.options = append(exporter.options, observer.WithShards(shards))
+	}
+}
+
+// WithBufferSize sets how many ConsumeTraces calls may be waiting for the
+// trace assembly before ConsumeTraces blocks.
+func WithBufferSize(size int) Option {
+	return func(exporter *Exporter) {
+		exporter.bufferSize = size
+	}
+}
+
+func (e *Exporter) Start(ctx context.Context) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.ch != nil {
+		return ErrStarted
+	}
+
+	composite := controller.NewComposite(e.controllers...)
+	options := append([]observer.Option{observer.WithController(composite)}, e.options...)
+	obs := observer.NewObserver(options...)
+
+	e.ch = make(chan receiver.Batch, e.bufferSize)
+	e.done = make(chan struct{})
+
+	var observeCtx context.Context
+	observeCtx, e.cancel = context.WithCancel(context.Background())
+	go func() {
+		defer close(e.done)
+		obs.Observe(observeCtx, e.ch)
+	}()
+
+	return nil
+}
+
+// ConsumeTraces adds the spans of td to the model. It blocks while the trace
+// assembly falls behind, until ctx is done.
+func (e *Exporter) ConsumeTraces(ctx context.Context, td ptrace.Traces) error {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	if e.ch == nil {
+		return ErrNotStarted
+	}
+
+	batch := toBatch(td)
+	if len(batch) == 0 {
+		return nil
+	}
+
+	select {
+	case e.ch <- batch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops the trace assembly and waits for it to exit.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.ch == nil {
+		return nil
+	}
+
+	e.cancel()
+	e.ch = nil
+
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// toBatch converts td into the spans the trace assembly works on, grouped by
+// trace ID.
+func toBatch(td ptrace.Traces) receiver.Batch {
+	batch := receiver.Batch{}
+
+	resourceSpans := td.ResourceSpans()
+	for i := 0; i < resourceSpans.Len(); i++ {
+		resourceSpan := resourceSpans.At(i)
+		serviceName, pod := "", ""
+		if value, ok := resourceSpan.Resource().Attributes().Get(string(semconv.ServiceNameKey)); ok {
+			serviceName = value.Str()
+		}
+		if value, ok := resourceSpan.Resource().Attributes().Get(string(semconv.K8SPodNameKey)); ok {
+			pod = value.Str()
+		}
+
+		scopeSpans := resourceSpan.ScopeSpans()
+		for j := 0; j < scopeSpans.Len(); j++ {
+			spans := scopeSpans.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				traceId, spanId := span.TraceID(), span.SpanID()
+
+				parent := ""
+				if parentId := span.ParentSpanID(); !parentId.IsEmpty() {
+					parent = hex.EncodeToString(parentId[:])
+				}
+
+				batch.Add(&receiver.Span{
+					Duration:    uint64(span.EndTimestamp() - span.StartTimestamp()),
+					Parent:      parent,
+					Pod:         pod,
+					ServiceName: serviceName,
+					SpanId:      hex.EncodeToString(spanId[:]),
+					StartTime:   uint64(span.StartTimestamp()),
+					TraceId:     hex.EncodeToString(traceId[:]),
+				})
+			}
+		}
+	}
+
+	return batch
+}
@@ -0,0 +1,75 @@
+package scaler_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pako-23/queue-scaler/pkg/scaler"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"gotest.tools/v3/assert"
+)
+
+type channelController chan string
+
+func (c channelController) Stabilize(state *scaler.QueueNetwork) error {
+	select {
+	case c <- state.ToDOT():
+	default:
+	}
+
+	return nil
+}
+
+func traces() ptrace.Traces {
+	td := ptrace.NewTraces()
+	traceId := pcommon.TraceID([16]byte{1})
+
+	addSpan := func(service string, spanId byte, parentId byte) {
+		resourceSpans := td.ResourceSpans().AppendEmpty()
+		resourceSpans.Resource().Attributes().PutStr("service.name", service)
+		span := resourceSpans.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+		span.SetTraceID(traceId)
+		span.SetSpanID(pcommon.SpanID([8]byte{spanId}))
+		if parentId != 0 {
+			span.SetParentSpanID(pcommon.SpanID([8]byte{parentId}))
+		}
+		span.SetStartTimestamp(pcommon.Timestamp(1000))
+		span.SetEndTimestamp(pcommon.Timestamp(1100))
+	}
+	addSpan("frontend", 1, 0)
+	addSpan("backend", 2, 1)
+
+	return td
+}
+
+func TestExporter(t *testing.T) {
+	t.Parallel()
+
+	models := make(channelController, 1)
+	exporter := scaler.NewExporter(
+		scaler.WithController("test", models),
+		scaler.WithInterval(10*time.Millisecond))
+
+	assert.ErrorIs(t, exporter.ConsumeTraces(context.Background(), traces()), scaler.ErrNotStarted)
+	assert.NilError(t, exporter.Start(context.Background()))
+	assert.ErrorIs(t, exporter.Start(context.Background()), scaler.ErrStarted)
+	assert.NilError(t, exporter.ConsumeTraces(context.Background(), traces()))
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case model := <-models:
+			if !strings.Contains(model, "backend") {
+				continue
+			}
+			assert.Assert(t, strings.Contains(model, "frontend"))
+			assert.NilError(t, exporter.Shutdown(context.Background()))
+			return
+		case <-timeout:
+			t.Fatal("no model received")
+		}
+	}
+}